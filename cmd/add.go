@@ -1,14 +1,16 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
-	"github.com/emersion/go-ical"
 	"github.com/kkga/tdx/vdir"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +18,11 @@ import (
 type addOptions struct {
 	list        string
 	description string
+	priority    string
+	afterDone   bool
+	parent      string
+	start       string
+	remind      []string
 }
 
 func NewAddCmd() *cobra.Command {
@@ -31,10 +38,19 @@ func NewAddCmd() *cobra.Command {
 		SuggestFor: []string{"new"},
 		Args:       cobra.MinimumNArgs(1),
 		Example: heredoc.Doc(`
-			$ tdx add buy milk -l shopping`),
+			$ tdx add buy milk -l shopping
+			$ tdx add call mom tomorrow p2 -l tasks
+			$ tdx add pay rent !!! -l tasks
+			$ tdx add read a book -P low -l tasks
+			$ tdx add water plants every 3 days --after-completion -l home
+			$ tdx add team meeting every monday at 10am -l work
+			$ tdx add book flights --parent 4 -l tasks
+			$ tdx add file taxes --start "next monday" -l tasks
+			$ tdx add dentist tomorrow 3pm --remind "1h before" -l tasks
+			$ tdx add pay rent friday --remind "thursday 9am" -l tasks`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
@@ -42,16 +58,26 @@ func NewAddCmd() *cobra.Command {
 				return err
 			}
 
-			var collection *vdir.Collection
-			for col := range vd {
-				if col.Name == opts.list {
-					collection = col
+			collection, err := vd.CollectionByName(opts.list)
+			if err != nil {
+				return err
+			}
+
+			// subtasks refer to their parent by UID
+			var parentUID string
+			if opts.parent != "" {
+				parent, err := selectItem(vd, []string{opts.parent}, &selectOptions{})
+				if err != nil {
+					return err
+				}
+				if parentUID = parent.UID(); parentUID == "" {
+					return fmt.Errorf("Parent todo has no UID: %q", opts.parent)
 				}
 			}
 
 			rawTodo := strings.Join(args, " ")
 
-			return runAdd(collection, opts, rawTodo)
+			return runAdd(vd, collection, opts, rawTodo, parentUID)
 		},
 	}
 
@@ -59,6 +85,11 @@ func NewAddCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&opts.list, "list", "l", "", "`LIST` for new todo")
 	cmd.MarkFlagRequired("list") // nolint: errcheck
 	cmd.Flags().StringVarP(&opts.description, "description", "d", "", "description text")
+	cmd.Flags().StringVarP(&opts.priority, "priority", "P", "", "`PRIORITY`: high, medium, low, !!!, !!, ! or p1-p9")
+	cmd.Flags().StringVar(&opts.start, "start", "", "defer todo until `DATE`, e.g. 'next monday'")
+	cmd.Flags().StringArrayVar(&opts.remind, "remind", nil, "remind at `TIME`, e.g. '1h before' (due) or 'tomorrow 9am'; can be repeated")
+	cmd.Flags().StringVar(&opts.parent, "parent", "", "add as a subtask of todo `SELECTOR`")
+	cmd.Flags().BoolVar(&opts.afterDone, "after-completion", false, "repeat counting from completion instead of due date")
 
 	defaultOpts := os.Getenv(envAddOptsVar)
 	err := cmd.ParseFlags(strings.Split(defaultOpts, " "))
@@ -69,65 +100,86 @@ func NewAddCmd() *cobra.Command {
 	return cmd
 }
 
-func runAdd(collection *vdir.Collection, opts *addOptions, rawTodo string) error {
-	cal := ical.NewCalendar()
-	t := ical.NewComponent(ical.CompToDo)
-	uid := vdir.GenerateUID()
-	t.Props.SetText(ical.PropStatus, string(vdir.StatusNeedsAction))
-	t.Props.SetText(ical.PropUID, uid)
-	cal.Children = append(cal.Children, t)
+func runAdd(vd *vdir.Vdir, collection *vdir.Collection, opts *addOptions, rawTodo string, parentUID string) error {
+	t := vdir.NewTodo()
+	t.SetParent(parentUID)
 
 	summary := rawTodo
 
-	if strings.Contains(summary, "!!!") {
-		summary = strings.Trim(strings.Replace(summary, "!!!", "", 1), " ")
-		prioProp := ical.NewProp(ical.PropPriority)
-		prioProp.Value = fmt.Sprint(vdir.PriorityHigh)
-		t.Props.Add(prioProp)
-	} else if strings.Contains(summary, "!!") {
-		summary = strings.Trim(strings.Replace(summary, "!!", "", 1), " ")
-		prioProp := ical.NewProp(ical.PropPriority)
-		prioProp.Value = fmt.Sprint(vdir.PriorityMedium)
-		t.Props.Add(prioProp)
-	} else if strings.Contains(summary, "!") {
-		summary = strings.Trim(strings.Replace(summary, "!", "", 1), " ")
-		prioProp := ical.NewProp(ical.PropPriority)
-		prioProp.Value = fmt.Sprint(vdir.PriorityLow)
-		t.Props.Add(prioProp)
-	}
-
-	if due, text, err := parseDate(summary); err == nil {
-		t.Props.SetDateTime(ical.PropDue, due)
-		summary = strings.Trim(strings.Replace(summary, text, "", 1), " ")
+	prio, summary := parsePriority(summary)
+	if opts.priority != "" {
+		p, err := vdir.ParsePriority(opts.priority)
+		if err != nil {
+			return err
+		}
+		prio = p
 	}
+	t.SetPriority(prio)
 
-	if opts.description != "" {
-		t.Props.SetText(ical.PropDescription, opts.description)
+	rule, text := parseRepeat(summary)
+	if rule != nil {
+		t.SetRRule(rule.String())
+		t.SetRepeatFromCompletion(opts.afterDone)
+		summary = strings.Join(strings.Fields(strings.Replace(summary, text, "", 1)), " ")
+	} else if opts.afterDone {
+		return errors.New("Repeat phrase required for --after-completion, e.g. 'every 3 days'")
 	}
 
-	t.Props.SetText(ical.PropSummary, summary)
+	if due, text, allDay, err := parseDate(summary); err == nil {
+		if rule != nil {
+			due = firstOccurrence(rule, due)
+		}
+		t.SetDue(due, allDay)
+		summary = strings.Trim(strings.Replace(summary, text, "", 1), " ")
+	} else if rule != nil {
+		y, m, d := time.Now().Date()
+		t.SetDue(firstOccurrence(rule, time.Date(y, m, d, 0, 0, 0, 0, time.Local)), true)
+	}
 
-	p := path.Join(collection.Path, fmt.Sprintf("%s.ics", uid))
+	if opts.start != "" {
+		start, _, allDay, err := parseDate(opts.start)
+		if err != nil {
+			return fmt.Errorf("Invalid start date: %q", opts.start)
+		}
+		t.SetStart(start, allDay)
+	}
 
-	item := &vdir.Item{
-		Path: p,
-		Ical: cal,
+	t.SetDescription(opts.description)
+	t.SetSummary(summary)
+	syncCategories(t, nil)
+
+	for _, r := range opts.remind {
+		a, err := parseReminder(r)
+		if err != nil {
+			return err
+		}
+		t.AddAlarm(a)
 	}
+	if err := checkReminders(t); err != nil {
+		return err
+	}
+
+	item := vd.NewItem(collection, t)
 	err := item.WriteFile()
 	if err != nil {
 		return fmt.Errorf("error writing file: %v", err)
 	}
 
-	vd := make(vdir.Vdir)
-	if err := vd.Init(vdirPath); err != nil {
+	// the new todo gets its ID from reloaded vdir
+	if err := vd.Init(vdirPath, initOptions()...); err != nil {
 		return err
 	}
 
-	addedItem, err := vd.ItemByPath(p)
+	addedItem, err := vd.ItemByPath(item.Path)
 	if err != nil {
 		return err
 	}
 
+	// a new subtask changes progress of its parents
+	if _, err := rollUp(vd, []*vdir.Item{addedItem}); err != nil {
+		return err
+	}
+
 	s, err := addedItem.Format()
 	if err != nil {
 		return err
@@ -136,3 +188,95 @@ func runAdd(collection *vdir.Collection, opts *addOptions, rawTodo string) error
 
 	return nil
 }
+
+var priorityRegexp = regexp.MustCompile(`(?i)(^|\s)p[0-9](\s|$)`)
+
+// parsePriority finds a priority notation (!!!, !!, ! or p0-p9) in summary
+// and returns the priority and summary without it
+func parsePriority(summary string) (vdir.ToDoPriority, string) {
+	if loc := priorityRegexp.FindStringIndex(summary); loc != nil {
+		prio, err := vdir.ParsePriority(summary[loc[0]:loc[1]])
+		if err == nil {
+			return prio, strings.Trim(summary[:loc[0]]+" "+summary[loc[1]:], " ")
+		}
+	}
+
+	for _, marks := range []string{"!!!", "!!", "!"} {
+		if strings.Contains(summary, marks) {
+			prio, _ := vdir.ParsePriority(marks)
+			return prio, strings.Trim(strings.Replace(summary, marks, "", 1), " ")
+		}
+	}
+
+	return vdir.PriorityNone, summary
+}
+
+const weekdayRe = `(mon|tue|tues|wed|thu|thur|thurs|fri|sat|sun)(?:day|nesday|sday|rsday|urday)?`
+
+var (
+	repeatIntervalRegexp = regexp.MustCompile(`(?i)\bevery\s+(?:(other)\s+|(\d+)\s+)?(day|week|month|year)s?\b(?:\s+at\b)?`)
+	repeatWeekdayRegexp  = regexp.MustCompile(`(?i)\bevery\s+(weekday|weekend|` + weekdayRe + `(?:(?:\s*,\s*|\s+and\s+|\s*,\s*and\s+)` + weekdayRe + `)*)\b(?:\s+at\b)?`)
+	weekdayRegexp        = regexp.MustCompile(`(?i)` + weekdayRe)
+)
+
+// parseRepeat finds a repeat phrase in s, such as 'every 2 weeks' or
+// 'every monday and friday', and returns a matching recurrence rule
+func parseRepeat(s string) (rule *vdir.RRule, text string) {
+	if m := repeatWeekdayRegexp.FindStringSubmatch(s); m != nil {
+		rule = &vdir.RRule{Freq: vdir.FreqWeekly, Interval: 1}
+		var days []string
+		switch strings.ToLower(m[1]) {
+		case "weekday":
+			days = []string{"mon", "tue", "wed", "thu", "fri"}
+		case "weekend":
+			days = []string{"sat", "sun"}
+		default:
+			for _, d := range weekdayRegexp.FindAllStringSubmatch(m[1], -1) {
+				days = append(days, d[1])
+			}
+		}
+		weekdays := map[string]time.Weekday{
+			"mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+			"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+			"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+		}
+		for _, d := range days {
+			rule.ByDay = append(rule.ByDay, vdir.WeekdayNum{Day: weekdays[strings.ToLower(d)]})
+		}
+		return rule, m[0]
+	}
+
+	if m := repeatIntervalRegexp.FindStringSubmatch(s); m != nil {
+		freqs := map[string]vdir.Frequency{
+			"day":   vdir.FreqDaily,
+			"week":  vdir.FreqWeekly,
+			"month": vdir.FreqMonthly,
+			"year":  vdir.FreqYearly,
+		}
+		rule = &vdir.RRule{Freq: freqs[strings.ToLower(m[3])], Interval: 1}
+		if m[1] != "" {
+			rule.Interval = 2
+		} else if n, err := strconv.Atoi(m[2]); err == nil && n > 0 {
+			rule.Interval = n
+		}
+		return rule, m[0]
+	}
+
+	return nil, ""
+}
+
+// firstOccurrence returns the first day on or after given date matching
+// rule weekdays, keeping time of day
+func firstOccurrence(rule *vdir.RRule, from time.Time) time.Time {
+	if len(rule.ByDay) == 0 {
+		return from
+	}
+	for d := from; d.Before(from.AddDate(0, 0, 7)); d = d.AddDate(0, 0, 1) {
+		for _, wd := range rule.ByDay {
+			if d.Weekday() == wd.Day {
+				return d
+			}
+		}
+	}
+	return from
+}
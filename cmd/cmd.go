@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -17,34 +16,100 @@ import (
 	"github.com/olebedev/when/rules/ru"
 )
 
-func checkList(vd vdir.Vdir, list string, required bool) error {
-	if list == "" && required {
-		return errors.New("List flag required. See 'tdx %s -h'")
-	} else if list != "" {
-		names := []string{}
-		for col := range vd {
-			names = append(names, col.Name)
-			if col.Name == list {
-				return nil
-			}
-		}
-		return fmt.Errorf("List does not exist: %q\nAvailable lists: %s", list, strings.Join(names, ", "))
-	} else {
+// initOptions returns vdir init options, the metadata cache is used unless
+// disabled with environment variable
+func initOptions() []vdir.InitOption {
+	const envNoCacheVar = "TDX_NO_CACHE"
+
+	if os.Getenv(envNoCacheVar) != "" {
 		return nil
 	}
+	return []vdir.InitOption{vdir.InitCache}
 }
 
-func stringsToInts(ss []string) (ints []int, err error) {
-	for _, s := range ss {
-		i, err := strconv.Atoi(s)
+// rollUp updates progress of parents after items were changed and returns
+// parents that were written. Parents are started and completed together
+// with their subtasks only if enabled with environment variable.
+func rollUp(vd *vdir.Vdir, items []*vdir.Item) (parents []*vdir.Item, err error) {
+	const envCompleteParentsVar = "TDX_COMPLETE_PARENTS"
+
+	setStatus := os.Getenv(envCompleteParentsVar) != ""
+	seen := make(map[*vdir.Item]bool)
+	for _, item := range items {
+		seen[item] = true
+	}
+
+	for _, item := range items {
+		updated, err := vd.RollUp(item, time.Now(), setStatus)
 		if err != nil {
-			return ints, fmt.Errorf("Invalid arg: %q", s)
+			return parents, err
+		}
+		for _, p := range updated {
+			if !seen[p] {
+				seen[p] = true
+				parents = append(parents, p)
+			}
 		}
-		ints = append(ints, i)
 	}
 	return
 }
 
+// warnNotRepeated warns if recurring todo t was completed because tdx
+// can't repeat its rule
+func warnNotRepeated(t *vdir.Todo) {
+	if t.Status() != vdir.StatusCompleted {
+		return
+	}
+	if err := t.RepeatError(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s, todo %q completed without repeating\n", err, t.Summary())
+	}
+}
+
+// syncCategories writes hashtags of todo to its CATEGORIES, so that other
+// programs see them, if enabled with environment variable. Categories of
+// removed hashtags are removed.
+func syncCategories(t *vdir.Todo, removed []vdir.Tag) {
+	const envSyncCategoriesVar = "TDX_SYNC_CATEGORIES"
+
+	if os.Getenv(envSyncCategoriesVar) != "" {
+		t.SyncCategories(removed)
+	}
+}
+
+// setTagSyntax sets tag prefix and pattern of tag names
+// from environment variables
+func setTagSyntax() error {
+	const (
+		envTagPrefixVar  = "TDX_TAG_PREFIX"
+		envTagPatternVar = "TDX_TAG_PATTERN"
+	)
+
+	prefix, pattern := os.Getenv(envTagPrefixVar), os.Getenv(envTagPatternVar)
+	if prefix == "" && pattern == "" {
+		return nil
+	}
+	if prefix == "" {
+		prefix = vdir.DefaultTagPrefix
+	}
+	if pattern == "" {
+		pattern = vdir.DefaultTagPattern
+	}
+	return vdir.SetTagSyntax(prefix, pattern)
+}
+
+func checkList(vd *vdir.Vdir, list string, required bool) error {
+	if list == "" && required {
+		return errors.New("List flag required. See 'tdx %s -h'")
+	} else if list != "" {
+		if _, err := vd.CollectionByName(list); err != nil {
+			return fmt.Errorf("%s\nAvailable lists: %s", err, strings.Join(vd.CollectionNames(), ", "))
+		}
+		return nil
+	} else {
+		return nil
+	}
+}
+
 func promptConfirm(label string, def bool) bool {
 	choices := "Y/n"
 	if !def {
@@ -72,28 +137,32 @@ func promptConfirm(label string, def bool) bool {
 	}
 }
 
-func parseDate(s string) (t time.Time, text string, err error) {
+// parseDate finds a natural language date in s, allDay is set when
+// no clock time was mentioned
+func parseDate(s string) (t time.Time, text string, allDay bool, err error) {
 	w := when.New(nil)
 	w.Add(en.All...)
 	w.Add(ru.All...)
 	w.Add(common.All...)
 
-	now := time.Now()
+	// clock times are entered in display timezone
+	now := time.Now().In(vdir.DisplayLocation())
 
 	r, err := w.Parse(s, now)
 	if err != nil {
-		return t, text, err
+		return t, text, allDay, err
 	}
 	if r == nil {
-		return t, text, errors.New("No date found")
+		return t, text, allDay, errors.New("No date found")
 	}
 
 	// strip clock from time if it's the same as now (i.e. not specified)
 	rH, rM, rS := r.Time.Clock()
 	nH, nM, nS := now.Clock()
-	if time.Date(0, 0, 0, rH, rM, rS, 0, time.Local).Equal(time.Date(0, 0, 0, nH, nM, nS, 0, time.Local)) {
+	if rH == nH && rM == nM && rS == nS {
 		y, m, d := r.Time.Date()
 		t = time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+		allDay = true
 	} else {
 		t = r.Time
 	}
@@ -110,6 +179,33 @@ func parseDate(s string) (t time.Time, text string, err error) {
 	return
 }
 
+// parseReminder parses a reminder relative to todo dates, such as
+// '1h before', or an absolute reminder given as a natural date
+func parseReminder(s string) (vdir.Alarm, error) {
+	if a, err := vdir.ParseAlarm(s); err == nil {
+		return a, nil
+	}
+	if t, _, _, err := parseDate(s); err == nil {
+		return vdir.Alarm{At: t.Truncate(time.Minute)}, nil
+	}
+	return vdir.Alarm{}, fmt.Errorf("Invalid reminder: %q", s)
+}
+
+// checkReminders returns an error if a relative reminder refers
+// to a date todo doesn't have
+func checkReminders(t *vdir.Todo) error {
+	for _, a := range t.Alarms() {
+		if _, ok := a.Time(t); ok {
+			continue
+		}
+		if a.FromDue {
+			return fmt.Errorf("Reminder requires a due date: %q", a)
+		}
+		return fmt.Errorf("Reminder requires a start date: %q", a)
+	}
+	return nil
+}
+
 func containsString(ss []string, s string) bool {
 	for _, a := range ss {
 		if a == s {
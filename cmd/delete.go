@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/MakeNowJust/heredoc/v2"
@@ -11,6 +10,7 @@ import (
 )
 
 type deleteOptions struct {
+	selectOptions
 	yes bool
 }
 
@@ -18,38 +18,31 @@ func NewDeleteCmd() *cobra.Command {
 	opts := &deleteOptions{}
 
 	cmd := &cobra.Command{
-		Use:     "delete <id>...",
+		Use:     "delete <selector>...",
 		Aliases: []string{"del"},
 		Short:   "Delete todos",
-		Long:    "Permanently delete todos.",
-		Args:    cobra.MinimumNArgs(1),
+		Long:    "Permanently delete todos.\n\n" + selectorHelp,
+		Args:    selectArgs(&opts.selectOptions),
 		Example: heredoc.Doc(`
 			$ tdx delete 1
-			$ tdx delete 1 2 3`),
+			$ tdx delete 1 2 3
+			$ tdx delete 3-7 e0a2e1`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
-			IDs, err := stringsToInts(args)
+			items, err := selectItems(vd, args, &opts.selectOptions)
 			if err != nil {
 				return err
 			}
 
-			var items []*vdir.Item
-			for _, id := range IDs {
-				item, err := vd.ItemById(id)
-				if err != nil {
-					return err
-				}
-				items = append(items, item)
-			}
-
 			return runDelete(items, opts)
 		},
 	}
 
+	addSelectFlags(cmd, &opts.selectOptions)
 	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "do not ask for confirmation")
 
 	return cmd
@@ -72,7 +65,7 @@ func runDelete(items []*vdir.Item, opts *deleteOptions) error {
 		ok := promptConfirm("Delete listed todos?", false)
 		if ok {
 			for _, i := range items {
-				if err := os.Remove(i.Path); err != nil {
+				if err := i.Delete(); err != nil {
 					return err
 				}
 			}
@@ -80,7 +73,7 @@ func runDelete(items []*vdir.Item, opts *deleteOptions) error {
 		}
 	} else {
 		for _, i := range items {
-			if err := os.Remove(i.Path); err != nil {
+			if err := i.Delete(); err != nil {
 				return err
 			}
 		}
@@ -2,89 +2,152 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
-	"github.com/emersion/go-ical"
 	"github.com/kkga/tdx/vdir"
 	"github.com/spf13/cobra"
 )
 
 type doneOptions struct {
-	toggle bool
+	selectOptions
+	toggle  bool
+	cascade bool
 }
 
 func NewDoneCmd() *cobra.Command {
 	opts := &doneOptions{}
 
 	cmd := &cobra.Command{
-		Use:     "done <id>...",
+		Use:     "done <selector>...",
 		Aliases: []string{"do"},
 		Short:   "Complete todos",
-		Long:    "Mark todos as completed.",
-		Args:    cobra.MinimumNArgs(1),
+		Long:    "Mark todos as completed.\n\n" + selectorHelp,
+		Args:    selectArgs(&opts.selectOptions),
 		Example: heredoc.Doc(`
 			$ tdx done 1
-			$ tdx done 1 2 3`),
+			$ tdx done 1 2 3
+			$ tdx done 3-7 e0a2e1
+			$ tdx done --where milk
+			$ tdx done 4 --cascade`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
-			IDs, err := stringsToInts(args)
+			items, err := selectItems(vd, args, &opts.selectOptions)
 			if err != nil {
 				return err
 			}
 
-			var items []*vdir.Item
-			for _, id := range IDs {
-				item, err := vd.ItemById(id)
-				if err != nil {
-					return err
-				}
-				items = append(items, item)
-			}
-
-			return runDone(items, opts)
+			return runDone(vd, items, opts)
 		},
 	}
 
+	addSelectFlags(cmd, &opts.selectOptions)
 	cmd.Flags().BoolVarP(&opts.toggle, "toggle", "t", false, "toggle completed state")
+	cmd.Flags().BoolVarP(&opts.cascade, "cascade", "c", false, "also complete open subtasks")
 
 	return cmd
 }
 
-func runDone(items []*vdir.Item, opts *doneOptions) error {
-	sb := strings.Builder{}
+func runDone(vd *vdir.Vdir, items []*vdir.Item, opts *doneOptions) error {
+	seen := make(map[*vdir.Item]bool)
+	for _, item := range items {
+		seen[item] = true
+	}
 
+	// open subtasks of completed todos are completed too or reported
+	var subtasks []*vdir.Item
 	for _, item := range items {
-		vtodo, err := item.Vtodo()
+		t, err := item.Todo()
 		if err != nil {
 			return err
 		}
+		if opts.toggle && t.Status() == vdir.StatusCompleted {
+			continue
+		}
 
-		if opts.toggle {
-			s, err := vtodo.Props.Text(ical.PropStatus)
+		var open []*vdir.Item
+		for _, child := range vd.Descendants(item) {
+			c, err := child.Todo()
 			if err != nil {
 				return err
 			}
-			switch vdir.ToDoStatus(s) {
-			case vdir.StatusCompleted:
-				vtodo.Props.SetText(ical.PropStatus, string(vdir.StatusNeedsAction))
-			case vdir.StatusNeedsAction, vdir.StatusCancelled:
-				vtodo.Props.SetText(ical.PropStatus, string(vdir.StatusCompleted))
-			default:
-				vtodo.Props.SetText(ical.PropStatus, string(vdir.StatusCompleted))
+			if s := c.Status(); !seen[child] && (s == vdir.StatusNeedsAction || s == vdir.StatusInProcess) {
+				seen[child] = true
+				open = append(open, child)
 			}
+		}
+		if len(open) == 0 {
+			continue
+		}
+		if opts.cascade {
+			subtasks = append(subtasks, open...)
 		} else {
-			vtodo.Props.SetText(ical.PropStatus, string(vdir.StatusCompleted))
+			fmt.Fprintf(os.Stderr, "Todo %d has %d open subtasks, use --cascade to complete them\n", item.Id, len(open))
 		}
+	}
+	items = append(items, subtasks...)
 
-		if err := item.WriteFile(); err != nil {
+	// open todos that may be unblocked by completed ones
+	blocked, err := vdir.Filter(vdir.ByStatus(vd.Items()), vdir.StatusOpen)
+	if err != nil {
+		return err
+	}
+	blocked, err = vdir.Filter(vdir.ByBlocked(blocked), true)
+	if err != nil {
+		return err
+	}
+
+	err = runStatus(vd, items, func(t *vdir.Todo) error {
+		if opts.toggle && t.Status() == vdir.StatusCompleted {
+			t.Reopen()
+			return nil
+		}
+		// recurring todos move to their next occurrence
+		if _, err := t.Complete(time.Now()); err != nil {
 			return err
 		}
+		warnNotRepeated(t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
+	targets := make(map[*vdir.Item]bool)
+	for _, item := range items {
+		targets[item] = true
+	}
+	return printUnblocked(vd, blocked, targets)
+}
+
+// printUnblocked prints open todos that are no longer blocked by open
+// dependencies, except for targets of the command
+func printUnblocked(vd *vdir.Vdir, blocked []*vdir.Item, targets map[*vdir.Item]bool) error {
+	sb := strings.Builder{}
+	for _, item := range blocked {
+		if targets[item] {
+			continue
+		}
+		// completing todos may have completed or cancelled their parents
+		if err := item.Reload(); err != nil {
+			return err
+		}
+		t, err := item.Todo()
+		if err != nil {
+			return err
+		}
+		if s := t.Status(); s != vdir.StatusNeedsAction && s != vdir.StatusInProcess {
+			continue
+		}
+		if vd.RefreshBlockers(item); len(item.Blockers()) > 0 {
+			continue
+		}
 		s, err := item.Format()
 		if err != nil {
 			return err
@@ -92,6 +155,8 @@ func runDone(items []*vdir.Item, opts *doneOptions) error {
 		sb.WriteString(s)
 	}
 
-	fmt.Print(sb.String())
+	if sb.Len() > 0 {
+		fmt.Printf("Unblocked:\n%s", sb.String())
+	}
 	return nil
 }
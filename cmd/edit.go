@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -17,7 +16,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
-type editOptions struct{}
+type editOptions struct {
+	selectOptions
+}
 
 const (
 	layoutDateTime = "2 Jan 2006 15:04"
@@ -25,44 +26,42 @@ const (
 )
 
 func NewEditCmd() *cobra.Command {
-	_ = &editOptions{}
+	opts := &editOptions{}
 
 	cmd := &cobra.Command{
-		Use:     "edit <id>",
+		Use:     "edit <selector>",
 		Aliases: []string{"e"},
 		Short:   "Edit todo",
-		Long:    "Edit todo content in external program.",
-		Args:    cobra.ExactArgs(1),
+		Long:    "Edit todo content in external program.\n\n" + selectorHelp,
+		Args:    cobra.MaximumNArgs(1),
 		Example: heredoc.Doc(`
-			$ tdx edit 1`),
+			$ tdx edit 1
+			$ tdx edit e0a2e1`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
-			IDs, err := stringsToInts(args)
-			if err != nil {
+			if err := selectArgs(&opts.selectOptions)(cmd, args); err != nil {
 				return err
 			}
 
-			var item *vdir.Item
-			for _, id := range IDs {
-				i, err := vd.ItemById(id)
-				if err != nil {
-					return err
-				}
-				item = i
+			item, err := selectItem(vd, args, &opts.selectOptions)
+			if err != nil {
+				return err
 			}
 
-			return runEdit(item)
+			return runEdit(vd, item)
 		},
 	}
 
+	addSelectFlags(cmd, &opts.selectOptions)
+
 	return cmd
 }
 
-func runEdit(item *vdir.Item) error {
+func runEdit(vd *vdir.Vdir, item *vdir.Item) error {
 	tmp, err := os.CreateTemp("", "tdx")
 	if err != nil {
 		return err
@@ -78,12 +77,13 @@ func runEdit(item *vdir.Item) error {
 		return errors.New("Set the VISUAL env variable to edit todos")
 	}
 
-	vtodo, err := item.Vtodo()
+	todo, err := item.Todo()
 	if err != nil {
 		return err
 	}
 
-	template := generateTemplate(*vtodo)
+	values := templateValues(todo)
+	template := generateTemplate(values)
 	_, err = tmp.Write([]byte(template))
 	if err != nil {
 		return err
@@ -102,75 +102,158 @@ func runEdit(item *vdir.Item) error {
 		return err
 	}
 
-	for p, newVal := range newProps {
-		curP := vtodo.Props.Get(p)
-		newP := ical.NewProp(p)
+	if err := applyTemplate(item, values, newProps); err != nil {
+		return err
+	}
 
-		if curP == nil && newVal == "" {
-			continue
+	if err := item.WriteFile(); err != nil {
+		var conflict *vdir.ConflictError
+		if !errors.As(err, &conflict) || !promptConfirm(fmt.Sprintf("%s\nRe-read todo and apply your changes?", err), false) {
+			return err
 		}
-
-		if curP != nil && curP.Value == "" && newVal == "" {
-			continue
+		if err := item.Reload(); err != nil {
+			return err
 		}
+		apply := func(i *vdir.Item) error { return applyTemplate(i, values, newProps) }
+		if err := item.Update(apply); err != nil {
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if _, err := rollUp(vd, []*vdir.Item{item}); err != nil {
+		return err
+	}
 
-		if curP != nil && curP.Value != "" && newVal == "" {
-			vtodo.Props.Del(p)
+	f, err := item.Format(vdir.FormatDescription, vdir.FormatMultiline)
+	if err != nil {
+		return err
+	}
+	fmt.Print(f)
+
+	return nil
+}
+
+var statusMap = map[vdir.ToDoStatus]string{
+	vdir.StatusNeedsAction: "[ ]",
+	vdir.StatusInProcess:   "[~]",
+	vdir.StatusCancelled:   "[-]",
+	vdir.StatusCompleted:   "[x]",
+}
+
+// applyTemplate sets item props to values parsed from edited template.
+// Only props changed in editor are set, others are kept as they are.
+func applyTemplate(item *vdir.Item, oldProps, newProps map[string]string) error {
+	t, err := item.Todo()
+	if err != nil {
+		return err
+	}
+
+	// reminders are checked once all dates are set
+	remindersChanged := false
+	hashtags := t.Hashtags()
+
+	for p, newVal := range newProps {
+		if old, ok := oldProps[p]; ok && old == newVal {
 			continue
 		}
 
 		switch p {
+		case ical.PropSummary:
+			t.SetSummary(newVal)
+			syncCategories(t, hashtags)
+		case ical.PropDescription:
+			t.SetDescription(newVal)
+			syncCategories(t, hashtags)
 		case ical.PropDue:
-			if t, _ := time.Parse(layoutDateTime, newVal); !t.IsZero() {
-				newP.SetDateTime(t)
-			} else if t, _ := time.Parse(layoutDate, newVal); !t.IsZero() {
-				newP.SetDateTime(t)
-			} else if due, _, err := parseDate(newVal); err == nil {
-				newP.SetDateTime(due)
+			d, allDay, err := parseTemplateDate(newVal)
+			if err != nil {
+				return fmt.Errorf("Invalid due date: %q", newVal)
+			}
+			t.SetDue(d, allDay)
+		case templateReminders:
+			var alarms []vdir.Alarm
+			for _, r := range strings.Split(newVal, ",") {
+				if r = strings.TrimSpace(r); r == "" {
+					continue
+				}
+				a, err := parseReminder(r)
+				if err != nil {
+					return err
+				}
+				alarms = append(alarms, a)
 			}
+			t.SetAlarms(alarms)
+			remindersChanged = true
+		case templateStart:
+			d, allDay, err := parseTemplateDate(newVal)
+			if err != nil {
+				return fmt.Errorf("Invalid start date: %q", newVal)
+			}
+			t.SetStart(d, allDay)
 		case ical.PropPriority:
-			prioMap := map[string]vdir.ToDoPriority{
-				"!!!": vdir.PriorityHigh,
-				"!!":  vdir.PriorityMedium,
-				"!":   vdir.PriorityLow,
+			prio, err := vdir.ParsePriority(newVal)
+			if err != nil {
+				return err
 			}
-			p := prioMap[newVal]
-			newP.Value = fmt.Sprint(p)
+			t.SetPriority(prio)
 		case ical.PropStatus:
-			statusMap := map[string]vdir.ToDoStatus{
-				"":    vdir.StatusNeedsAction,
-				"[ ]": vdir.StatusNeedsAction,
-				"[-]": vdir.StatusCancelled,
-				"[x]": vdir.StatusCompleted,
-				"[X]": vdir.StatusCompleted,
+			status := vdir.ToDoStatus(newVal)
+			for k, v := range statusMap {
+				if v == strings.ToLower(newVal) {
+					status = k
+				}
 			}
-			if s, exists := statusMap[newVal]; exists {
-				newP.Value = fmt.Sprint(s)
-			} else {
-				newP.Value = newVal
+			if newVal == "" {
+				status = vdir.StatusNeedsAction
+			}
+			switch status {
+			case vdir.StatusCompleted:
+				if _, err := t.Complete(time.Now()); err != nil {
+					return err
+				}
+				warnNotRepeated(t)
+			case vdir.StatusInProcess:
+				t.MarkInProcess()
+			case vdir.StatusCancelled:
+				t.MarkCancelled()
+			case vdir.StatusNeedsAction:
+				t.Reopen()
+			default:
+				t.SetStatus(status)
 			}
 		default:
-			newP.Value = newVal
+			if newVal == "" {
+				t.Props.Del(p)
+			} else {
+				t.Props.SetText(p, newVal)
+			}
 		}
-
-		vtodo.Props.Set(newP)
 	}
 
-	if err := item.WriteFile(); err != nil {
-		return err
+	if remindersChanged {
+		return checkReminders(t)
 	}
+	return nil
+}
 
-	if err := tmp.Close(); err != nil {
-		return err
+// parseTemplateDate parses a date entered in edit template,
+// an empty value is a zero time
+func parseTemplateDate(s string) (time.Time, bool, error) {
+	if s == "" {
+		return time.Time{}, false, nil
 	}
-
-	f, err := item.Format(vdir.FormatDescription, vdir.FormatMultiline)
-	if err != nil {
-		return err
+	if d, err := time.ParseInLocation(layoutDateTime, s, vdir.DisplayLocation()); err == nil {
+		return d, false, nil
 	}
-	fmt.Print(f)
-
-	return nil
+	if d, err := time.ParseInLocation(layoutDate, s, time.Local); err == nil {
+		return d, true, nil
+	}
+	d, _, allDay, err := parseDate(s)
+	return d, allDay, err
 }
 
 func parseTemplate(f *os.File) (map[string]string, error) {
@@ -199,67 +282,55 @@ func parseTemplate(f *os.File) (map[string]string, error) {
 	return props, nil
 }
 
-func generateTemplate(vtodo ical.Component) string {
-	sb := strings.Builder{}
+const (
+	// templateStart is a template field for DTSTART
+	templateStart = "START"
+	// templateReminders is a template field for VALARM components
+	templateReminders = "REMINDERS"
+)
 
-	props := map[string]string{
-		ical.PropSummary:     "",
-		ical.PropDescription: "",
-		ical.PropStatus:      "",
-		ical.PropPriority:    "",
-		ical.PropDue:         "",
-		ical.PropLocation:    "",
-	}
+// templateProps are props shown in edit template, in order
+var templateProps = []string{
+	ical.PropSummary,
+	ical.PropDescription,
+	ical.PropStatus,
+	ical.PropPriority,
+	templateStart,
+	ical.PropDue,
+	templateReminders,
+	ical.PropLocation,
+}
 
-	prioMap := map[vdir.ToDoPriority]string{
-		vdir.PriorityHigh:   "!!!",
-		vdir.PriorityMedium: "!!",
-		vdir.PriorityLow:    "!",
+// templateValues returns todo values as they are shown in edit template
+func templateValues(t *vdir.Todo) map[string]string {
+	status, known := statusMap[t.Status()]
+	if !known {
+		status = string(t.Status())
 	}
+	location, _ := t.Props.Text(ical.PropLocation)
 
-	statusMap := map[vdir.ToDoStatus]string{
-		vdir.StatusNeedsAction: "[ ]",
-		vdir.StatusCancelled:   "[-]",
-		vdir.StatusCompleted:   "[x]",
+	var reminders []string
+	for _, a := range t.Alarms() {
+		reminders = append(reminders, a.String())
 	}
 
-	for name, prop := range vtodo.Props {
-		p := prop[0]
-		if _, exists := props[name]; exists {
-			var val string
-			switch name {
-			case ical.PropDue:
-				date, _ := p.DateTime(time.Local)
-				if !date.IsZero() {
-					val = date.Format(layoutDateTime)
-				}
-			case ical.PropPriority:
-				curPrio, _ := strconv.Atoi(strings.Trim(p.Value, " "))
-				val = prioMap[vdir.ToDoPriority(curPrio)]
-			case ical.PropStatus:
-				if v, exists := statusMap[vdir.ToDoStatus(strings.Trim(p.Value, " "))]; exists {
-					val = v
-				} else {
-					val = p.Value
-				}
-			default:
-				val = p.Value
-			}
-			props[p.Name] = val
-		}
+	return map[string]string{
+		ical.PropSummary:     t.Summary(),
+		ical.PropDescription: t.Description(),
+		ical.PropStatus:      status,
+		ical.PropPriority:    t.Priority().String(),
+		templateStart:        formatTemplateDate(t.Start()),
+		ical.PropDue:         formatTemplateDate(t.Due()),
+		templateReminders:    strings.Join(reminders, ", "),
+		ical.PropLocation:    location,
 	}
+}
 
-	order := []string{
-		ical.PropSummary,
-		ical.PropDescription,
-		ical.PropStatus,
-		ical.PropPriority,
-		ical.PropDue,
-		ical.PropLocation,
-	}
+func generateTemplate(values map[string]string) string {
+	sb := strings.Builder{}
 
-	for _, p := range order {
-		sb.WriteString(fmt.Sprintf("%s: %s\n", p, props[p]))
+	for _, p := range templateProps {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", p, values[p]))
 	}
 
 	sb.WriteString(templateHelp)
@@ -267,24 +338,45 @@ func generateTemplate(vtodo ical.Component) string {
 	return sb.String()
 }
 
+// formatTemplateDate formats a date for edit template
+func formatTemplateDate(d time.Time, allDay bool) string {
+	switch {
+	case d.IsZero():
+		return ""
+	case allDay:
+		return d.Format(layoutDate)
+	default:
+		return d.In(vdir.DisplayLocation()).Format(layoutDateTime)
+	}
+}
+
 const templateHelp = `
 --------------------
 
 Edit todo fields above. Here's a cheatsheet.
 
-DUE accepts following formats:
+START and DUE accept following formats:
 - 2 Jan 2006 15:04
 - 2 Jan 2006
 - natural date; same as <add>: see 'tdx add -h'
 
+Todos with START in the future are hidden from <list>.
+
+REMINDERS is a comma-separated list of:
+- 1h before, 2 days before due, 30m after start, 30s before, at due
+- 2 Jan 2006 15:04
+- natural date; same as <add>
+
 STATUS:
 - [ ]
+- [~] (in process)
 - [x]
 - [-] (cancelled)
 
 PRIORITY:
-- !!!
-- !!
-- !
+- !!! or high (1)
+- !! or medium (5)
+- ! or low (6)
+- p1 (highest) to p9 (lowest)
 - [empty]
 `
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+type linkOptions struct {
+	selectOptions
+	blocks    string
+	dependsOn string
+}
+
+// dependency is a link between a todo and a todo it depends on
+type dependency struct {
+	dependent *vdir.Item
+	dep       *vdir.Item
+}
+
+func NewLinkCmd() *cobra.Command {
+	opts := &linkOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "link <selector>... (--blocks | --depends-on) <selector>",
+		Short: "Link dependent todos",
+		Long:  "Make todos depend on another todo. Todos that depend on open todos are blocked.\n\n" + selectorHelp,
+		Args:  selectArgs(&opts.selectOptions),
+		Example: heredoc.Doc(`
+			$ tdx link 5 --blocks 7
+			$ tdx link 7 8 --depends-on 5`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			deps, err := selectDependencies(vd, args, opts)
+			if err != nil {
+				return err
+			}
+
+			return runLink(vd, deps)
+		},
+	}
+
+	addLinkFlags(cmd, opts)
+
+	return cmd
+}
+
+func NewUnlinkCmd() *cobra.Command {
+	opts := &linkOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "unlink <selector>... (--blocks | --depends-on) <selector>",
+		Short: "Unlink dependent todos",
+		Long:  "Remove dependencies between todos.\n\n" + selectorHelp,
+		Args:  selectArgs(&opts.selectOptions),
+		Example: heredoc.Doc(`
+			$ tdx unlink 5 --blocks 7
+			$ tdx unlink 7 --depends-on 5`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			deps, err := selectDependencies(vd, args, opts)
+			if err != nil {
+				return err
+			}
+
+			return runUnlink(vd, deps)
+		},
+	}
+
+	addLinkFlags(cmd, opts)
+
+	return cmd
+}
+
+func addLinkFlags(cmd *cobra.Command, opts *linkOptions) {
+	addSelectFlags(cmd, &opts.selectOptions)
+	cmd.Flags().StringVar(&opts.blocks, "blocks", "", "selected todos block todo `SELECTOR`")
+	cmd.Flags().StringVar(&opts.dependsOn, "depends-on", "", "selected todos depend on todo `SELECTOR`")
+}
+
+// selectDependencies resolves selected todos and the todo given with
+// --blocks or --depends-on into dependencies
+func selectDependencies(vd *vdir.Vdir, args []string, opts *linkOptions) (deps []dependency, err error) {
+	if (opts.blocks == "") == (opts.dependsOn == "") {
+		return nil, errors.New("Requires either --blocks or --depends-on flag")
+	}
+
+	items, err := selectItems(vd, args, &opts.selectOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := selectItem(vd, []string{opts.blocks + opts.dependsOn}, &selectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		d := dependency{dependent: item, dep: target}
+		if opts.blocks != "" {
+			d = dependency{dependent: target, dep: item}
+		}
+		if d.dependent.UID() == "" || d.dep.UID() == "" {
+			return nil, fmt.Errorf("Todo without UID can not be linked: %d", item.Id)
+		}
+		deps = append(deps, d)
+	}
+	return
+}
+
+func runLink(vd *vdir.Vdir, deps []dependency) error {
+	for _, d := range deps {
+		if cycle := vd.DependencyCycle(d.dependent, d.dep); cycle != nil {
+			ids := make([]string, len(cycle))
+			for n, item := range cycle {
+				ids[n] = strconv.Itoa(item.Id)
+			}
+			return fmt.Errorf("Link would create a dependency cycle: %s", strings.Join(ids, " -> "))
+		}
+
+		uid := d.dep.UID()
+		err := d.dependent.Update(func(i *vdir.Item) error {
+			t, err := i.Todo()
+			if err != nil {
+				return err
+			}
+			t.AddDependency(uid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return printDependents(vd, deps)
+}
+
+func runUnlink(vd *vdir.Vdir, deps []dependency) error {
+	for _, d := range deps {
+		uid := d.dep.UID()
+		err := d.dependent.Update(func(i *vdir.Item) error {
+			t, err := i.Todo()
+			if err != nil {
+				return err
+			}
+			if !t.RemoveDependency(uid) {
+				return fmt.Errorf("Todo %d does not depend on todo %d", d.dependent.Id, d.dep.Id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return printDependents(vd, deps)
+}
+
+// printDependents prints every changed dependent todo once
+func printDependents(vd *vdir.Vdir, deps []dependency) error {
+	sb := strings.Builder{}
+	seen := make(map[*vdir.Item]bool)
+	for _, d := range deps {
+		if seen[d.dependent] {
+			continue
+		}
+		seen[d.dependent] = true
+
+		vd.RefreshBlockers(d.dependent)
+		s, err := d.dependent.Format()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(s)
+	}
+
+	fmt.Print(sb.String())
+	return nil
+}
@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"github.com/fatih/color"
@@ -20,9 +22,16 @@ type listOptions struct {
 	sorting       string
 	group         string
 	due           int
+	prio          string
 	status        string
 	tags          []string
 	tagsExcluded  []string
+	topLevel      bool
+	childrenOf    string
+	blocked       bool
+	actionable    bool
+	allDates      bool
+	soon          int
 	description   bool
 	multiline     bool
 
@@ -33,10 +42,11 @@ type listOptions struct {
 type sortOption string
 
 const (
-	sortOptionStatus  sortOption = "STATUS"
-	sortOptionPrio    sortOption = "PRIO"
-	sortOptionDue     sortOption = "DUE"
-	sortOptionCreated sortOption = "CREATED"
+	sortOptionStatus   sortOption = "STATUS"
+	sortOptionPrio     sortOption = "PRIO"
+	sortOptionDue      sortOption = "DUE"
+	sortOptionCreated  sortOption = "CREATED"
+	sortOptionProgress sortOption = "PROGRESS"
 )
 
 type groupOption string
@@ -58,10 +68,17 @@ func NewListCmd() *cobra.Command {
 		Short:   "List todos",
 		Long:    "List todos, optionally filtered by query.",
 		Example: heredoc.Doc(`
-            $ tdx list --sort prio --due 2`),
+            $ tdx list --sort prio --due 2
+            $ tdx list --prio high
+            $ tdx list --prio '<=p3'
+            $ tdx list --children-of 4
+            $ tdx list --sort progress --top-level
+            $ tdx list --actionable
+            $ tdx list --all-dates
+            $ tdx list --tag work/clientA --group tag`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
@@ -77,23 +94,29 @@ func NewListCmd() *cobra.Command {
 				return err
 			}
 
-			// if lists flag set, delete other collections from vdir
+			if opts.blocked && opts.actionable {
+				return errors.New("Flags --blocked and --actionable can not be used together")
+			}
+
+			// if lists flag set, only list todos from given collections
+			collections := vd.Collections()
 			if len(opts.lists) > 0 && !opts.allLists {
+				collections = nil
 				for _, list := range opts.lists {
 					if err := checkList(vd, list, false); err != nil {
 						return err
 					}
 				}
-				for col := range vd {
-					if !containsString(opts.lists, col.Name) {
-						delete(vd, col)
+				for _, col := range vd.Collections() {
+					if containsString(opts.lists, col.Name) {
+						collections = append(collections, col)
 					}
 				}
 			}
 
 			query := strings.Join(args, "")
 
-			return runList(vd, query, opts)
+			return runList(vd, collections, query, opts)
 		},
 	}
 
@@ -102,10 +125,17 @@ func NewListCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&opts.group, "group", "g", "list", "group listed todos, valid options: list, tag, none ")
 	cmd.Flags().BoolVarP(&opts.allLists, "all", "a", false, "show todos from all lists (overrides -l)")
 	cmd.Flags().IntVarP(&opts.due, "due", "d", 0, "filter by due date in next `N` days")
-	cmd.Flags().StringVarP(&opts.status, "status", "S", "needs-action", "filter by `STATUS`: needs-action, completed, cancelled, any")
-	cmd.Flags().StringSliceVarP(&opts.tags, "tag", "t", []string{}, "filter todos by given `TAGS`")
-	cmd.Flags().StringSliceVarP(&opts.tagsExcluded, "no-tag", "T", []string{}, "exclude todos with given `TAGS`")
-	cmd.Flags().StringVarP(&opts.sorting, "sort", "s", "prio", "sort by `FIELD`: prio, due, status, created")
+	cmd.Flags().StringVarP(&opts.prio, "prio", "P", "", "filter by `PRIORITY`: high, medium, low, none, or p1-p9 with optional <, <=, >, >=")
+	cmd.Flags().StringVarP(&opts.status, "status", "S", "open", "filter by `STATUS`: open (needs-action or in-process), needs-action, in-process, completed, cancelled, any")
+	cmd.Flags().StringSliceVarP(&opts.tags, "tag", "t", []string{}, "filter todos by given `TAGS`, including nested tags")
+	cmd.Flags().StringSliceVarP(&opts.tagsExcluded, "no-tag", "T", []string{}, "exclude todos with given `TAGS`, including nested tags")
+	cmd.Flags().BoolVar(&opts.topLevel, "top-level", false, "show only top-level todos, without subtasks")
+	cmd.Flags().StringVar(&opts.childrenOf, "children-of", "", "show only direct subtasks of todo `SELECTOR`")
+	cmd.Flags().BoolVar(&opts.blocked, "blocked", false, "show only todos blocked by open dependencies")
+	cmd.Flags().BoolVar(&opts.actionable, "actionable", false, "show only todos that are not blocked")
+	cmd.Flags().BoolVar(&opts.allDates, "all-dates", false, "show todos with start date in the future")
+	cmd.Flags().IntVar(&opts.soon, "soon", 3, "show todos starting in next `N` days in a separate group")
+	cmd.Flags().StringVarP(&opts.sorting, "sort", "s", "prio", "sort by `FIELD`: prio, due, status, created, progress")
 	cmd.Flags().BoolVar(&opts.description, "description", false, "show description in output")
 	cmd.Flags().BoolVar(&opts.multiline, "two-line", false, "use 2-line output for dates and description")
 
@@ -118,7 +148,19 @@ func NewListCmd() *cobra.Command {
 	return cmd
 }
 
-func runList(vd vdir.Vdir, query string, opts *listOptions) error {
+func runList(vd *vdir.Vdir, collections []*vdir.Collection, query string, opts *listOptions) error {
+	// subtasks of a todo are filtered by UID of the todo
+	var parents []string
+	if opts.childrenOf != "" {
+		parent, err := selectItem(vd, []string{opts.childrenOf}, &selectOptions{})
+		if err != nil {
+			return err
+		}
+		parents = append(parents, parent.UID())
+	}
+
+	// todos that start soon are collected by filterItems and listed separately
+	var soon []*vdir.Item
 
 	filterItems := func(items []*vdir.Item) (filtered []*vdir.Item, err error) {
 		filtered = items
@@ -146,6 +188,35 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 			return
 		}
 
+		if opts.prio != "" {
+			r, err := vdir.ParsePriorityRange(opts.prio)
+			if err != nil {
+				return nil, err
+			}
+			filtered, err = vdir.Filter(vdir.ByPriority(filtered), r)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		filtered, err = vdir.Filter(vdir.ByTopLevel(filtered), opts.topLevel)
+		if err != nil {
+			return
+		}
+		filtered, err = vdir.Filter(vdir.ByParent(filtered), parents)
+		if err != nil {
+			return
+		}
+
+		filtered, err = vdir.Filter(vdir.ByBlocked(filtered), opts.blocked)
+		if err != nil {
+			return
+		}
+		filtered, err = vdir.Filter(vdir.ByActionable(filtered), opts.actionable)
+		if err != nil {
+			return
+		}
+
 		filtered, err = vdir.Filter(vdir.ByDue(filtered), opts.due)
 		if err != nil {
 			return
@@ -155,6 +226,31 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 			return
 		}
 
+		// todos with start date in the future are hidden
+		if !opts.allDates {
+			now := time.Now()
+			deferred := filtered
+			filtered, err = vdir.Filter(vdir.ByStart(deferred), now)
+			if err != nil {
+				return
+			}
+			if opts.soon > 0 {
+				upcoming, err := vdir.Filter(vdir.ByStart(deferred), now.AddDate(0, 0, opts.soon))
+				if err != nil {
+					return nil, err
+				}
+				current := make(map[*vdir.Item]bool)
+				for _, item := range filtered {
+					current[item] = true
+				}
+				for _, item := range upcoming {
+					if !current[item] {
+						soon = append(soon, item)
+					}
+				}
+			}
+		}
+
 		return
 
 	}
@@ -169,15 +265,20 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 			sort.Sort(vdir.ByStatus(items))
 		case sortOptionCreated:
 			sort.Sort(vdir.ByCreated(items))
+		case sortOptionProgress:
+			sort.Sort(vdir.ByProgress(items))
 		}
 	}
 
-	var m = make(map[string][]*vdir.Item)
+	var (
+		m       = make(map[string][]*vdir.Item)
+		tagTree []*vdir.TagNode
+	)
 
 	switch groupOption(strings.ToUpper(opts.group)) {
 	case groupOptionList:
-		for col, items := range vd {
-			items, err := filterItems(items)
+		for _, col := range collections {
+			items, err := filterItems(vd.CollectionItems(col))
 			if err != nil {
 				return err
 			}
@@ -188,8 +289,8 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 		}
 	case groupOptionTag:
 		items := []*vdir.Item{}
-		for _, ii := range vd {
-			items = append(items, ii...)
+		for _, col := range collections {
+			items = append(items, vd.CollectionItems(col)...)
 		}
 
 		items, err := filterItems(items)
@@ -206,18 +307,20 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 			if err != nil {
 				return err
 			}
-			if len(tags) > 0 {
-				for _, tag := range tags {
-					m[tag.String()] = append(m[tag.String()], item)
-				}
-			} else {
+			if len(tags) == 0 {
 				m[emptyTag.String()] = append(m[emptyTag.String()], item)
 			}
 		}
+
+		// tagged todos are listed in a tree of nested tags
+		tagTree, err = vdir.TagTree(items)
+		if err != nil {
+			return err
+		}
 	case groupOptionNone:
 		items := []*vdir.Item{}
-		for _, ii := range vd {
-			items = append(items, ii...)
+		for _, col := range collections {
+			items = append(items, vd.CollectionItems(col)...)
 		}
 
 		items, err := filterItems(items)
@@ -232,7 +335,7 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 		m[string(noneKey)] = append(m[string(noneKey)], items...)
 	}
 
-	if len(m) == 0 {
+	if len(m) == 0 && len(tagTree) == 0 && len(soon) == 0 {
 		return fmt.Errorf("No todos found")
 	}
 
@@ -249,8 +352,25 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 		if key != string(groupOptionNone) {
 			sb.WriteString(colGroup(fmt.Sprintf("-- %s --\n", key)))
 		}
-		for _, i := range m[key] {
-			if err := writeItem(&sb, *i, opts); err != nil {
+		// subtasks are listed under their parents
+		for _, i := range vdir.Tree(m[key]) {
+			if err := writeItem(&sb, i.Item, i.Depth, opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, n := range tagTree {
+		if err := writeTagNode(&sb, n, 0, opts); err != nil {
+			return err
+		}
+	}
+
+	if len(soon) > 0 {
+		sort.Sort(vdir.ByStart(soon))
+		sb.WriteString(colGroup("-- starts soon --\n"))
+		for _, i := range vdir.Tree(soon) {
+			if err := writeItem(&sb, i.Item, i.Depth, opts); err != nil {
 				return err
 			}
 		}
@@ -261,7 +381,28 @@ func runList(vd vdir.Vdir, query string, opts *listOptions) error {
 	return nil
 }
 
-func writeItem(sb *strings.Builder, item vdir.Item, opts *listOptions) error {
+// writeTagNode writes a group of todos having tag of node, followed by
+// groups of nested tags indented by their depth
+func writeTagNode(sb *strings.Builder, node *vdir.TagNode, depth int, opts *listOptions) error {
+	colGroup := color.New(color.Bold, color.FgGreen).SprintFunc()
+	indent := strings.Repeat("  ", depth)
+	sb.WriteString(colGroup(fmt.Sprintf("%s-- %s (%d) --\n", indent, node.Tag.Name(), node.Count)))
+
+	for _, i := range vdir.Tree(node.Items) {
+		if err := writeItem(sb, i.Item, i.Depth, opts); err != nil {
+			return err
+		}
+	}
+	for _, child := range node.Children {
+		if err := writeTagNode(sb, child, depth+1, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeItem writes formatted item, subtasks are indented by their depth
+func writeItem(sb *strings.Builder, item *vdir.Item, depth int, opts *listOptions) error {
 	formatOpts := []vdir.FormatOption{}
 	if opts.multiline {
 		formatOpts = append(formatOpts, vdir.FormatMultiline)
@@ -275,6 +416,14 @@ func writeItem(sb *strings.Builder, item vdir.Item, opts *listOptions) error {
 		return err
 	}
 
+	if depth > 0 {
+		// indent after ID column, so that IDs stay aligned
+		indent := strings.Repeat("  ", depth)
+		idWidth := len(fmt.Sprintf("%2d", item.Id))
+		s = s[:idWidth] + indent + s[idWidth:]
+		s = strings.ReplaceAll(s, "\n       ", "\n       "+indent)
+	}
+
 	sb.WriteString(s)
 
 	return nil
@@ -284,7 +433,7 @@ func checkStatusFlag(flag string) error {
 	switch vdir.ToDoStatus(strings.ToUpper(flag)) {
 	case "":
 		return nil
-	case vdir.StatusNeedsAction, vdir.StatusCompleted, vdir.StatusCancelled, vdir.StatusAny:
+	case vdir.StatusOpen, vdir.StatusNeedsAction, vdir.StatusInProcess, vdir.StatusCompleted, vdir.StatusCancelled, vdir.StatusAny:
 		return nil
 	default:
 		return fmt.Errorf("Unknown status filter: %q, see %q", flag, "tdx list -h")
@@ -295,7 +444,7 @@ func checkSortFlag(flag string) error {
 	switch sortOption(strings.ToUpper(flag)) {
 	case "":
 		return nil
-	case sortOptionStatus, sortOptionPrio, sortOptionDue, sortOptionCreated:
+	case sortOptionStatus, sortOptionPrio, sortOptionDue, sortOptionCreated, sortOptionProgress:
 		return nil
 	default:
 		return fmt.Errorf("Unknown sort option: %q, see %q", flag, "tdx list -h")
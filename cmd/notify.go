@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+type notifyOptions struct {
+	command  string
+	once     bool
+	interval time.Duration
+}
+
+// notification holds todo details passed to notification command
+type notification struct {
+	ID          int    `json:"id"`
+	UID         string `json:"uid"`
+	List        string `json:"list"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Priority    int    `json:"priority"`
+	Due         string `json:"due"`
+	Start       string `json:"start"`
+	Reminder    string `json:"reminder"`
+	Time        string `json:"time"`
+}
+
+func NewNotifyCmd() *cobra.Command {
+	const envNotifyCommandVar = "TDX_NOTIFY_COMMAND"
+
+	opts := &notifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "notify [options]",
+		Short: "Run a command for due todos and reminders",
+		Long: heredoc.Doc(`
+			Watch todos and run a command when a todo falls due or its reminder triggers.
+
+			The command is run with 'sh -c'. Todo details are passed in TDX_TODO_ID,
+			TDX_TODO_UID, TDX_TODO_LIST, TDX_TODO_SUMMARY, TDX_TODO_DESCRIPTION,
+			TDX_TODO_STATUS, TDX_TODO_PRIORITY, TDX_TODO_DUE, TDX_TODO_START,
+			TDX_TODO_REMINDER ('due' or the reminder) and TDX_TODO_TIME environment
+			variables, and as a JSON object with the same fields on stdin.
+			Without a command, todos are printed to stdout.
+
+			The time of the last notification is stored in vdir, so that reminders
+			missed while tdx wasn't running fire on the next run and nothing fires twice.
+			If the command fails, the reminder fires again on the next run.
+			The first run only stores the time.`),
+		Args: cobra.NoArgs,
+		Example: heredoc.Doc(`
+			$ tdx notify -c 'notify-send "$TDX_TODO_SUMMARY" "$TDX_TODO_REMINDER"'
+			$ tdx notify --once -c 'jq -r .summary | mail -s reminder me@example.com'`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.interval <= 0 {
+				return fmt.Errorf("Invalid interval: %q", opts.interval)
+			}
+			return runNotify(opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.command, "command", "c", os.Getenv(envNotifyCommandVar), "`COMMAND` to run for every todo")
+	cmd.Flags().BoolVar(&opts.once, "once", false, "fire reminders since the last run and exit, e.g. from cron")
+	cmd.Flags().DurationVar(&opts.interval, "interval", time.Minute, "reload todos every `DURATION`")
+
+	return cmd
+}
+
+func runNotify(opts *notifyOptions) error {
+	fire := func(r vdir.Reminder) error {
+		return runNotifyCommand(opts.command, r)
+	}
+
+	for started := false; ; started = true {
+		vd := &vdir.Vdir{}
+		if err := vd.Init(vdirPath, initOptions()...); err != nil {
+			if opts.once || !started {
+				return err
+			}
+			// vdir may be in the middle of a sync, try again later
+			fmt.Fprintln(os.Stderr, err)
+			time.Sleep(opts.interval)
+			continue
+		}
+
+		now := time.Now()
+		err := vd.Notify(now, fire)
+		if opts.once {
+			return err
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		// wake up early for reminders due before the next reload
+		wait := opts.interval
+		upcoming, err := vd.Reminders(now, now.Add(wait))
+		if err == nil && len(upcoming) > 0 {
+			wait = upcoming[0].Time.Sub(now)
+		}
+		time.Sleep(wait)
+	}
+}
+
+// runNotifyCommand runs notification command for reminder r,
+// todo is printed to stdout if command is empty
+func runNotifyCommand(command string, r vdir.Reminder) error {
+	if command == "" {
+		s, err := r.Item.Format()
+		if err != nil {
+			return err
+		}
+		fmt.Print(s)
+		return nil
+	}
+
+	n, err := newNotification(r)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"TDX_TODO_ID="+strconv.Itoa(n.ID),
+		"TDX_TODO_UID="+n.UID,
+		"TDX_TODO_LIST="+n.List,
+		"TDX_TODO_SUMMARY="+n.Summary,
+		"TDX_TODO_DESCRIPTION="+n.Description,
+		"TDX_TODO_STATUS="+n.Status,
+		"TDX_TODO_PRIORITY="+strconv.Itoa(n.Priority),
+		"TDX_TODO_DUE="+n.Due,
+		"TDX_TODO_START="+n.Start,
+		"TDX_TODO_REMINDER="+n.Reminder,
+		"TDX_TODO_TIME="+n.Time,
+	)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Notification command failed for todo %d: %s", n.ID, err)
+	}
+	return nil
+}
+
+// newNotification returns details of todo reminder r fired for
+func newNotification(r vdir.Reminder) (*notification, error) {
+	t, err := r.Item.Todo()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &notification{
+		ID:          r.Item.Id,
+		UID:         t.UID(),
+		List:        r.Collection.Name,
+		Summary:     t.Summary(),
+		Description: t.Description(),
+		Status:      t.Status().String(),
+		Priority:    int(t.Priority()),
+		Reminder:    "due",
+		Time:        r.Time.In(vdir.DisplayLocation()).Format(time.RFC3339),
+	}
+	if due, _ := t.Due(); !due.IsZero() {
+		n.Due = due.In(vdir.DisplayLocation()).Format(time.RFC3339)
+	}
+	if start, _ := t.Start(); !start.IsZero() {
+		n.Start = start.In(vdir.DisplayLocation()).Format(time.RFC3339)
+	}
+	if r.Alarm != nil {
+		n.Reminder = r.Alarm.String()
+	}
+	return n, nil
+}
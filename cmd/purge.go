@@ -3,10 +3,8 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"os"
 	"strings"
 
-	"github.com/emersion/go-ical"
 	"github.com/kkga/tdx/vdir"
 	"github.com/spf13/cobra"
 )
@@ -18,27 +16,21 @@ func NewPurgeCmd() *cobra.Command {
 		Long:  "Permanently delete completed and cancelled todos.",
 		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
 			var toDelete []*vdir.Item
-			for _, items := range vd {
-				for _, item := range items {
-					vtodo, err := item.Vtodo()
-					if err != nil {
-						return err
-					}
-					s, err := vtodo.Props.Text(ical.PropStatus)
-					if err != nil {
-						return err
-					}
+			for _, item := range vd.Items() {
+				t, err := item.Todo()
+				if err != nil {
+					return err
+				}
 
-					switch vdir.ToDoStatus(s) {
-					case vdir.StatusCancelled, vdir.StatusCompleted:
-						toDelete = append(toDelete, item)
-					}
+				switch t.Status() {
+				case vdir.StatusCancelled, vdir.StatusCompleted:
+					toDelete = append(toDelete, item)
 				}
 			}
 
@@ -69,7 +61,7 @@ func runPurge(items []*vdir.Item) error {
 	ok := promptConfirm("Delete listed todos?", false)
 	if ok {
 		for _, i := range items {
-			if err := os.Remove(i.Path); err != nil {
+			if err := i.Delete(); err != nil {
 				return err
 			}
 		}
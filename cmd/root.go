@@ -3,12 +3,15 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/kkga/tdx/vdir"
 	"github.com/spf13/cobra"
 )
 
 var (
 	vdirPath   string
+	timezone   string
 	version    = "dev"
 	defaultCmd = NewListCmd()
 
@@ -17,6 +20,21 @@ var (
 		Short:        "tdx -- todo manager for vdir (iCalendar) files.",
 		Version:      version,
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := setTagSyntax(); err != nil {
+				return err
+			}
+			if timezone == "" {
+				return nil
+			}
+			loc, err := time.LoadLocation(timezone)
+			if err != nil {
+				return fmt.Errorf("Unknown timezone: %q", timezone)
+			}
+			// floating and all-day dates are still read in local time
+			vdir.SetDisplayLocation(loc)
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return defaultCmd.Execute()
@@ -42,16 +60,25 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVarP(&vdirPath, "path", "p", defaultPath, "path to vdir folder")
 	rootCmd.MarkFlagRequired("path") // nolint: errcheck
+	rootCmd.PersistentFlags().StringVar(&timezone, "tz", "", "show and enter dates in `TIMEZONE`, e.g. Europe/Berlin")
 
 	cobra.EnableCommandSorting = false
 	rootCmd.AddCommand(
 		NewAddCmd(),
 		NewListCmd(),
 		NewDoneCmd(),
+		NewStartCmd(),
+		NewCancelCmd(),
+		NewReopenCmd(),
+		NewLinkCmd(),
+		NewUnlinkCmd(),
+		NewTagCmd(),
+		NewTagsCmd(),
 		NewEditCmd(),
 		NewShowCmd(),
 		NewDeleteCmd(),
 		NewPurgeCmd(),
+		NewNotifyCmd(),
 		NewDocsCmd(),
 	)
 }
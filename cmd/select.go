@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+// uidSelectorPrefix marks a selector as a UID prefix, e.g. for UIDs made of digits
+const uidSelectorPrefix = "uid:"
+
+// selectOptions holds flags shared by commands that operate on selected todos
+type selectOptions struct {
+	where  string
+	status string
+}
+
+const selectorHelp = `Todos are selected by ID (e.g. '4'), ID range (e.g. '3-7'),
+unique UID prefix (e.g. 'e0a2e1' or 'uid:1697') or by a --where query,
+which matches open todos unless --status is given.`
+
+// addSelectFlags adds selection flags to cmd, --where matches todos with
+// opts.status if it's set, open todos otherwise
+func addSelectFlags(cmd *cobra.Command, opts *selectOptions) {
+	defaultStatus := opts.status
+	if defaultStatus == "" {
+		defaultStatus = "open"
+	}
+	cmd.Flags().StringVarP(&opts.where, "where", "w", "", "select todos with summary matching `QUERY`")
+	cmd.Flags().StringVarP(&opts.status, "status", "S", defaultStatus, "select --where matches by `STATUS`: open, needs-action, in-process, completed, cancelled, any")
+}
+
+// selectArgs returns a cobra args validator that requires either selectors or a query
+func selectArgs(opts *selectOptions) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && opts.where == "" {
+			return fmt.Errorf("Requires at least one todo selector or --where query. See 'tdx %s -h'", cmd.Name())
+		}
+		return nil
+	}
+}
+
+// selectItems resolves selectors and query into a list of unique items,
+// preserving the order in which they were given
+func selectItems(vd *vdir.Vdir, args []string, opts *selectOptions) (items []*vdir.Item, err error) {
+	seen := make(map[*vdir.Item]bool)
+	add := func(item *vdir.Item) {
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+
+	for _, arg := range args {
+		selected, err := parseSelector(vd, arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range selected {
+			add(item)
+		}
+	}
+
+	if opts.where != "" {
+		if err := checkStatusFlag(opts.status); err != nil {
+			return nil, err
+		}
+		matched, err := vdir.Filter(vdir.ByStatus(vd.Items()), vdir.ToDoStatus(opts.status))
+		if err != nil {
+			return nil, err
+		}
+		matched, err = vdir.Filter(vdir.ByText(matched), opts.where)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("No todos match query: %q", opts.where)
+		}
+		for _, item := range matched {
+			add(item)
+		}
+	}
+
+	return
+}
+
+// selectItem resolves selectors and query into exactly one item
+func selectItem(vd *vdir.Vdir, args []string, opts *selectOptions) (*vdir.Item, error) {
+	items, err := selectItems(vd, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != 1 {
+		return nil, fmt.Errorf("Expected a single todo, got %d", len(items))
+	}
+	return items[0], nil
+}
+
+// parseSelector resolves a single selector: an ID, an ID range or a UID prefix.
+// Numeric selectors are always IDs, generated UIDs start with digits too.
+func parseSelector(vd *vdir.Vdir, s string) ([]*vdir.Item, error) {
+	if s == "" {
+		return nil, errors.New("Empty selector")
+	}
+
+	if strings.HasPrefix(s, uidSelectorPrefix) {
+		item, err := vd.ItemByUIDPrefix(strings.TrimPrefix(s, uidSelectorPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return []*vdir.Item{item}, nil
+	}
+
+	if id, err := strconv.Atoi(s); err == nil {
+		item, err := vd.ItemById(id)
+		if err != nil {
+			return nil, err
+		}
+		return []*vdir.Item{item}, nil
+	}
+
+	if from, to, ok := parseRange(s); ok {
+		if from > to {
+			return nil, fmt.Errorf("Invalid range: %q", s)
+		}
+		// IDs of removed todos are skipped
+		var items []*vdir.Item
+		for _, item := range vd.Items() {
+			if item.Id >= from && item.Id <= to {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil, fmt.Errorf("No todos in range: %q", s)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Id < items[j].Id })
+		return items, nil
+	}
+
+	item, err := vd.ItemByUIDPrefix(s)
+	if err != nil {
+		return nil, err
+	}
+	return []*vdir.Item{item}, nil
+}
+
+// parseRange parses an ID range such as '3-7'
+func parseRange(s string) (from, to int, ok bool) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	from, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	to, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/kkga/tdx/vdir"
+)
+
+// newTestVdir returns a vdir with a collection of todos having given
+// UIDs and statuses, summaries are UIDs
+func newTestVdir(t *testing.T, todos map[string]vdir.ToDoStatus) *vdir.Vdir {
+	t.Helper()
+	dir := t.TempDir()
+	col := filepath.Join(dir, "tasks")
+	if err := os.Mkdir(col, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for uid, status := range todos {
+		data := strings.Join([]string{
+			"BEGIN:VCALENDAR",
+			"VERSION:2.0",
+			"PRODID:test",
+			"BEGIN:VTODO",
+			"UID:" + uid,
+			"DTSTAMP:20211114T025541Z",
+			"SUMMARY:" + uid,
+			"STATUS:" + string(status),
+			"END:VTODO",
+			"END:VCALENDAR",
+			"",
+		}, "\r\n")
+		if err := os.WriteFile(filepath.Join(col, uid+".ics"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vd := &vdir.Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	return vd
+}
+
+func TestParseSelector(t *testing.T) {
+	vd := newTestVdir(t, map[string]vdir.ToDoStatus{
+		"1700000000000000001-a": vdir.StatusNeedsAction,
+		"1697000000000000002-b": vdir.StatusNeedsAction,
+		"e0a2e171-8314":         vdir.StatusCompleted,
+	})
+	idOf := make(map[string]int)
+	for _, item := range vd.Items() {
+		idOf[item.UID()] = item.Id
+	}
+
+	var tests = []struct {
+		selector string
+		want     []string
+		wantErr  bool
+	}{
+		{fmt.Sprint(idOf["e0a2e171-8314"]), []string{"e0a2e171-8314"}, false},
+		{"1-2", []string{uidOfID(idOf, 1), uidOfID(idOf, 2)}, false},
+		{"e0a2", []string{"e0a2e171-8314"}, false},
+		{"uid:1700", []string{"1700000000000000001-a"}, false},
+		{"1697000000000000002-", []string{"1697000000000000002-b"}, false},
+		{"17", nil, true}, // numeric selectors are never UID prefixes
+		{"uid:1", nil, true},
+		{"2-1", nil, true},
+		{"2-9", []string{uidOfID(idOf, 2), uidOfID(idOf, 3)}, false},
+		{"5-9", nil, true},
+		{"f00", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			items, err := parseSelector(vd, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSelector(%q) error = %v, wantErr %v", tt.selector, err, tt.wantErr)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.UID())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("parseSelector(%q) mismatch (-want +got):\n%s", tt.selector, diff)
+			}
+		})
+	}
+}
+
+func TestParseSelectorRangeGap(t *testing.T) {
+	vd := newTestVdir(t, map[string]vdir.ToDoStatus{
+		"a": vdir.StatusNeedsAction,
+		"b": vdir.StatusNeedsAction,
+		"c": vdir.StatusNeedsAction,
+	})
+	idOf := make(map[string]int)
+	var removed *vdir.Item
+	for _, item := range vd.Items() {
+		idOf[item.UID()] = item.Id
+		if item.Id == 2 {
+			removed = item
+		}
+	}
+	if err := os.Remove(removed.Path); err != nil {
+		t.Fatal(err)
+	}
+	vd = &vdir.Vdir{}
+	if err := vd.Init(filepath.Dir(filepath.Dir(removed.Path))); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := parseSelector(vd, "1-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, item.UID())
+	}
+	want := []string{uidOfID(idOf, 1), uidOfID(idOf, 3)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parseSelector(%q) mismatch (-want +got):\n%s", "1-3", diff)
+	}
+}
+
+// uidOfID returns a UID having id in map of UIDs to IDs
+func uidOfID(ids map[string]int, id int) string {
+	for uid, n := range ids {
+		if n == id {
+			return uid
+		}
+	}
+	return ""
+}
+
+func TestParseRange(t *testing.T) {
+	var tests = []struct {
+		s        string
+		from, to int
+		ok       bool
+	}{
+		{"3-7", 3, 7, true},
+		{"7-3", 7, 3, true},
+		{"3", 0, 0, false},
+		{"3-", 0, 0, false},
+		{"-7", 0, 0, false},
+		{"3-7-9", 0, 0, false},
+		{"e0a2-e1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			from, to, ok := parseRange(tt.s)
+			if from != tt.from || to != tt.to || ok != tt.ok {
+				t.Errorf("parseRange(%q) = %d, %d, %v, want %d, %d, %v", tt.s, from, to, ok, tt.from, tt.to, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSelectItemsWhere(t *testing.T) {
+	vd := newTestVdir(t, map[string]vdir.ToDoStatus{
+		"milk-open": vdir.StatusNeedsAction,
+		"milk-done": vdir.StatusCompleted,
+	})
+
+	var tests = []struct {
+		status string
+		want   []string
+	}{
+		{"open", []string{"milk-open"}},
+		{"completed", []string{"milk-done"}},
+		{"any", []string{"milk-done", "milk-open"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			items, err := selectItems(vd, nil, &selectOptions{where: "milk", status: tt.status})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.UID())
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("selectItems() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := selectItems(vd, nil, &selectOptions{where: "milk", status: "done"}); err == nil {
+		t.Error("selectItems(): want error for unknown status")
+	}
+}
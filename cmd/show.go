@@ -10,6 +10,7 @@ import (
 )
 
 type showOptions struct {
+	selectOptions
 	raw bool
 }
 
@@ -17,43 +18,36 @@ func NewShowCmd() *cobra.Command {
 	opts := &showOptions{}
 
 	cmd := &cobra.Command{
-		Use:   "show [options] <todo>...",
+		Use:   "show [options] <selector>...",
 		Short: "Show todos",
-		Long:  "Show detailed info about todos",
-		Args:  cobra.MinimumNArgs(1),
+		Long:  "Show detailed info about todos.\n\n" + selectorHelp,
+		Args:  selectArgs(&opts.selectOptions),
 		Example: heredoc.Doc(`
 			$ tdx show 1
-			$ tdx show 1 2 3`),
+			$ tdx show 1 2 3
+			$ tdx show e0a2e1`),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			vd := make(vdir.Vdir)
-			if err := vd.Init(vdirPath); err != nil {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
 				return err
 			}
 
-			IDs, err := stringsToInts(args)
+			items, err := selectItems(vd, args, &opts.selectOptions)
 			if err != nil {
 				return err
 			}
 
-			var items []*vdir.Item
-			for _, id := range IDs {
-				item, err := vd.ItemById(id)
-				if err != nil {
-					return err
-				}
-				items = append(items, item)
-			}
-
-			return runShow(items, opts)
+			return runShow(vd, items, opts)
 		},
 	}
 
+	addSelectFlags(cmd, &opts.selectOptions)
 	cmd.Flags().BoolVarP(&opts.raw, "raw", "r", false, "raw output")
 
 	return cmd
 }
 
-func runShow(items []*vdir.Item, opts *showOptions) error {
+func runShow(vd *vdir.Vdir, items []*vdir.Item, opts *showOptions) error {
 	sb := strings.Builder{}
 
 	for i, item := range items {
@@ -74,6 +68,15 @@ func runShow(items []*vdir.Item, opts *showOptions) error {
 
 		sb.WriteString(s)
 
+		if subtasks := vd.Descendants(item); !opts.raw && len(subtasks) > 0 {
+			sb.WriteString("SUBTASKS:\n")
+			for _, t := range vdir.Tree(subtasks) {
+				if err := writeItem(&sb, t.Item, t.Depth, &listOptions{}); err != nil {
+					return err
+				}
+			}
+		}
+
 		if i < len(items)-1 {
 			sb.WriteString("\n")
 		}
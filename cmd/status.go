@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+type startOptions struct {
+	selectOptions
+	progress int
+}
+
+func NewStartCmd() *cobra.Command {
+	opts := &startOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "start <selector>...",
+		Short: "Start todos",
+		Long:  "Mark todos as in process, optionally with progress in percent.\n\n" + selectorHelp,
+		Args:  selectArgs(&opts.selectOptions),
+		Example: heredoc.Doc(`
+			$ tdx start 1
+			$ tdx start 1 --progress 40`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			items, err := selectItems(vd, args, &opts.selectOptions)
+			if err != nil {
+				return err
+			}
+
+			progress := -1
+			if cmd.Flags().Changed("progress") {
+				progress = opts.progress
+			}
+
+			return runStatus(vd, items, func(t *vdir.Todo) error {
+				if progress < 0 {
+					t.MarkInProcess()
+					return nil
+				}
+				if err := t.SetProgress(progress, time.Now()); err != nil {
+					return err
+				}
+				warnNotRepeated(t)
+				return nil
+			})
+		},
+	}
+
+	addSelectFlags(cmd, &opts.selectOptions)
+	cmd.Flags().IntVar(&opts.progress, "progress", 0, "set progress to `N` percent, 0 reopens and 100 completes todos")
+
+	return cmd
+}
+
+func NewCancelCmd() *cobra.Command {
+	opts := &selectOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "cancel <selector>...",
+		Short: "Cancel todos",
+		Long:  "Mark todos as cancelled.\n\n" + selectorHelp,
+		Args:  selectArgs(opts),
+		Example: heredoc.Doc(`
+			$ tdx cancel 1
+			$ tdx cancel 3-7`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			items, err := selectItems(vd, args, opts)
+			if err != nil {
+				return err
+			}
+
+			return runStatus(vd, items, func(t *vdir.Todo) error {
+				t.MarkCancelled()
+				return nil
+			})
+		},
+	}
+
+	addSelectFlags(cmd, opts)
+
+	return cmd
+}
+
+func NewReopenCmd() *cobra.Command {
+	// closed todos are what --where usually looks for
+	opts := &selectOptions{status: "any"}
+
+	cmd := &cobra.Command{
+		Use:   "reopen <selector>...",
+		Short: "Reopen todos",
+		Long:  "Mark completed, cancelled or started todos as needing action.\n\n" + selectorHelp,
+		Args:  selectArgs(opts),
+		Example: heredoc.Doc(`
+			$ tdx reopen 1
+			$ tdx reopen --where milk`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			items, err := selectItems(vd, args, opts)
+			if err != nil {
+				return err
+			}
+
+			return runStatus(vd, items, func(t *vdir.Todo) error {
+				t.Reopen()
+				return nil
+			})
+		},
+	}
+
+	addSelectFlags(cmd, opts)
+
+	return cmd
+}
+
+// runStatus applies status change to every item and prints changed todos,
+// including parents whose progress changed
+func runStatus(vd *vdir.Vdir, items []*vdir.Item, mark func(t *vdir.Todo) error) error {
+	if err := markItems(items, mark); err != nil {
+		return err
+	}
+	parents, err := rollUp(vd, items)
+	if err != nil {
+		return err
+	}
+	return printItems(append(items, parents...))
+}
+
+// runMark applies a change that doesn't affect progress to every item
+// and prints changed todos
+func runMark(items []*vdir.Item, mark func(t *vdir.Todo) error) error {
+	if err := markItems(items, mark); err != nil {
+		return err
+	}
+	return printItems(items)
+}
+
+// markItems applies mark to todo of every item and writes it
+func markItems(items []*vdir.Item, mark func(t *vdir.Todo) error) error {
+	update := func(item *vdir.Item) error {
+		t, err := item.Todo()
+		if err != nil {
+			return err
+		}
+		return mark(t)
+	}
+
+	for _, item := range items {
+		// re-read and retry if the todo was changed by another program
+		if err := item.Update(update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printItems prints formatted items
+func printItems(items []*vdir.Item) error {
+	sb := strings.Builder{}
+	for _, item := range items {
+		s, err := item.Format()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(s)
+	}
+
+	fmt.Print(sb.String())
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+const (
+	tagStoreSummary    = "summary"
+	tagStoreCategories = "categories"
+)
+
+type tagOptions struct {
+	selectOptions
+	store string
+}
+
+func NewTagCmd() *cobra.Command {
+	const envTagStoreVar = "TDX_TAG_STORE"
+
+	opts := &tagOptions{}
+
+	defaultStore := os.Getenv(envTagStoreVar)
+	if defaultStore == "" {
+		defaultStore = tagStoreSummary
+	}
+
+	cmd := &cobra.Command{
+		Use:   "tag [options] <selector>... +tag... -tag...",
+		Short: "Tag todos",
+		Long: heredoc.Doc(`
+			Add tags prefixed with '+' to todos and remove tags prefixed with '-'.
+
+			New tags are added as hashtags at the end of summary, or to CATEGORIES
+			with '--store categories'. Removed tags are stripped from summary,
+			description and CATEGORIES. Options go before selectors.
+
+			`) + selectorHelp,
+		Args: func(cmd *cobra.Command, args []string) error {
+			selectors, add, remove, err := parseTagArgs(args)
+			if err != nil {
+				return err
+			}
+			if len(add) == 0 && len(remove) == 0 {
+				return fmt.Errorf("Requires at least one +tag or -tag. See 'tdx %s -h'", cmd.Name())
+			}
+			return selectArgs(&opts.selectOptions)(cmd, selectors)
+		},
+		Example: heredoc.Doc(`
+			$ tdx tag 4 +work
+			$ tdx tag 3-7 e0a2e1 +errands -someday
+			$ tdx tag --where milk +shopping`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.store != tagStoreSummary && opts.store != tagStoreCategories {
+				return fmt.Errorf("Unknown tag store: %q, use %s or %s", opts.store, tagStoreSummary, tagStoreCategories)
+			}
+
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+
+			selectors, add, remove, _ := parseTagArgs(args)
+			items, err := selectItems(vd, selectors, &opts.selectOptions)
+			if err != nil {
+				return err
+			}
+
+			return runMark(items, func(t *vdir.Todo) error {
+				for _, tag := range remove {
+					t.RemoveTag(tag)
+				}
+				for _, tag := range add {
+					t.AddTag(tag, opts.store == tagStoreCategories)
+				}
+				syncCategories(t, remove)
+				return nil
+			})
+		},
+	}
+
+	// tags prefixed with '-' are arguments, not flags
+	cmd.Flags().SetInterspersed(false)
+	addSelectFlags(cmd, &opts.selectOptions)
+	cmd.Flags().StringVarP(&opts.store, "store", "s", defaultStore, "add tags to `STORE`: summary or categories")
+
+	return cmd
+}
+
+// parseTagArgs splits tag command arguments into todo selectors,
+// tags to add and tags to remove
+func parseTagArgs(args []string) (selectors []string, add, remove []vdir.Tag, err error) {
+	for _, arg := range args {
+		if len(arg) < 2 || !strings.HasPrefix(arg, "+") && !strings.HasPrefix(arg, "-") {
+			selectors = append(selectors, arg)
+			continue
+		}
+		tag, err := vdir.ParseTag(arg[1:])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if arg[0] == '+' {
+			add = append(add, tag)
+		} else {
+			remove = append(remove, tag)
+		}
+	}
+	return
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/fatih/color"
+	"github.com/kkga/tdx/vdir"
+	"github.com/spf13/cobra"
+)
+
+func NewTagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "List, rename and merge tags",
+		Long:  "Show all tags with numbers of open and all todos having them,\nincluding nested tags, ignoring case.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+			return runTags(vd)
+		},
+	}
+
+	cmd.AddCommand(
+		NewTagsRenameCmd(),
+		NewTagsMergeCmd(),
+	)
+
+	return cmd
+}
+
+func NewTagsRenameCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rename <old> <new>",
+		Short: "Rename a tag",
+		Long:  "Rename a tag and its nested tags in all todos, hashtags are replaced in place.",
+		Args:  cobra.ExactArgs(2),
+		Example: heredoc.Doc(`
+			$ tdx tags rename bugs bug
+			$ tdx tags rename Bug bug
+			$ tdx tags rename clientA work/clientA`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := vdir.ParseTag(args[0])
+			if err != nil {
+				return err
+			}
+			to, err := vdir.ParseTag(args[1])
+			if err != nil {
+				return err
+			}
+
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+			return runRenameTags(vd, []vdir.Tag{from}, to)
+		},
+	}
+
+	return cmd
+}
+
+func NewTagsMergeCmd() *cobra.Command {
+	var into string
+
+	cmd := &cobra.Command{
+		Use:   "merge <tag>... --into <tag>",
+		Short: "Merge tags",
+		Long: heredoc.Doc(`
+			Replace tags with a single tag in all todos. Todos that already
+			have the target tag lose the merged ones.`),
+		Args: cobra.MinimumNArgs(1),
+		Example: heredoc.Doc(`
+			$ tdx tags merge bugs Bug --into bug
+			$ tdx tags merge chores errands --into home`),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to, err := vdir.ParseTag(into)
+			if err != nil {
+				return err
+			}
+			var from []vdir.Tag
+			for _, arg := range args {
+				tag, err := vdir.ParseTag(arg)
+				if err != nil {
+					return err
+				}
+				from = append(from, tag)
+			}
+
+			vd := &vdir.Vdir{}
+			if err := vd.Init(vdirPath, initOptions()...); err != nil {
+				return err
+			}
+			return runRenameTags(vd, from, to)
+		},
+	}
+
+	cmd.Flags().StringVar(&into, "into", "", "merge tags into `TAG`")
+	cmd.MarkFlagRequired("into") // nolint: errcheck
+
+	return cmd
+}
+
+func runTags(vd *vdir.Vdir) error {
+	counts, err := vd.TagCounts()
+	if err != nil {
+		return err
+	}
+	if len(counts) == 0 {
+		return errors.New("No tags found")
+	}
+
+	width := 0
+	for _, c := range counts {
+		if n := utf8.RuneCountInString(string(c.Tag)); n > width {
+			width = n
+		}
+	}
+
+	c := color.New(color.FgBlue).SprintFunc()
+	sb := strings.Builder{}
+	for _, tc := range counts {
+		tag := fmt.Sprintf("%-*s", width, string(tc.Tag))
+		sb.WriteString(fmt.Sprintf("%s %4d open %4d total\n", c(tag), tc.Open, tc.Total))
+	}
+	fmt.Print(sb.String())
+
+	return nil
+}
+
+// errTagsUnchanged stops an update of a todo having no tags to rename
+var errTagsUnchanged = errors.New("Tags unchanged")
+
+// runRenameTags replaces tags from with tag to in all todos
+// and prints changed todos
+func runRenameTags(vd *vdir.Vdir, from []vdir.Tag, to vdir.Tag) error {
+	tags, err := vd.Tags()
+	if err != nil {
+		return err
+	}
+	for _, tag := range from {
+		found := false
+		for _, t := range tags {
+			found = found || tag.Includes(t)
+		}
+		if !found {
+			return fmt.Errorf("Unknown tag: %q", tag.String())
+		}
+	}
+
+	rename := func(t *vdir.Todo) (changed bool) {
+		for _, tag := range from {
+			if t.RenameTag(tag, to) {
+				changed = true
+			}
+		}
+		return
+	}
+
+	sb := strings.Builder{}
+	updated := 0
+	for _, item := range vd.Items() {
+		found := false
+		for _, tag := range from {
+			hasTag, err := item.HasTag(tag)
+			if err != nil {
+				return err
+			}
+			found = found || hasTag
+		}
+		if !found {
+			continue
+		}
+
+		// renaming is repeated if todo was changed by another program,
+		// it's applied only here, as renaming twice nests tags renamed
+		// into their own children, e.g. #work/clientA/clientA
+		err := item.Update(func(i *vdir.Item) error {
+			t, err := i.Todo()
+			if err != nil {
+				return err
+			}
+			if !rename(t) {
+				return errTagsUnchanged
+			}
+			return nil
+		})
+		if errors.Is(err, errTagsUnchanged) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		updated++
+
+		s, err := item.Format()
+		if err != nil {
+			return err
+		}
+		sb.WriteString(s)
+	}
+
+	fmt.Print(sb.String())
+	fmt.Printf("Updated: %d todos\n", updated)
+	return nil
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/kkga/tdx/vdir"
+)
+
+func TestRenameTagsIntoChild(t *testing.T) {
+	vd := newTestVdir(t, map[string]vdir.ToDoStatus{"a": vdir.StatusNeedsAction})
+	item := vd.Items()[0]
+	err := item.Update(func(i *vdir.Item) error {
+		t, err := i.Todo()
+		if err != nil {
+			return err
+		}
+		t.SetSummary("Call #work")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runRenameTags(vd, []vdir.Tag{"#work"}, "#work/clientA"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := item.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	todo, err := item.Todo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := todo.Summary(), "Call #work/clientA"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
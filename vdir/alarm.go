@@ -0,0 +1,292 @@
+package vdir
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Alarm is a reminder of a todo, stored as a VALARM component.
+// A relative alarm triggers at an offset from todo start or due date,
+// an absolute alarm triggers at a given time.
+type Alarm struct {
+	Offset  time.Duration `json:"offset,omitempty"`  // offset of relative alarm, negative before the date
+	FromDue bool          `json:"fromDue,omitempty"` // relative alarm is related to DUE instead of DTSTART
+	At      time.Time     `json:"at"`                // time of absolute alarm
+}
+
+// alarmLayout is a layout of absolute alarm times in alarm strings
+const alarmLayout = "2 Jan 2006 15:04"
+
+var (
+	alarmRelativeRegexp = regexp.MustCompile(`(?i)^(?:(.+?)\s+(before|after)|at)(?:\s+(due|start))?$`)
+	alarmDurationRegexp = regexp.MustCompile(`(?i)(\d+)\s*(weeks?|w|days?|d|hours?|h|minutes?|mins?|m|seconds?|secs?|s)`)
+)
+
+// IsRelative reports whether alarm triggers relative to todo dates
+func (a Alarm) IsRelative() bool {
+	return a.At.IsZero()
+}
+
+// Time returns the time alarm triggers for todo,
+// false if a relative alarm refers to a date todo doesn't have
+func (a Alarm) Time(t *Todo) (time.Time, bool) {
+	start, _ := t.Start()
+	due, _ := t.Due()
+	return a.time(start, due)
+}
+
+// time returns the time alarm triggers for todo with given start and due date
+func (a Alarm) time(start, due time.Time) (time.Time, bool) {
+	if !a.IsRelative() {
+		return a.At, true
+	}
+	d := start
+	if a.FromDue {
+		d = due
+	}
+	if d.IsZero() {
+		return time.Time{}, false
+	}
+	return d.Add(a.Offset), true
+}
+
+// String returns alarm as it's written for ParseAlarm,
+// e.g. '1h before due' or '2 Jan 2006 15:04'
+func (a Alarm) String() string {
+	if !a.IsRelative() {
+		return a.At.In(DisplayLocation()).Format(alarmLayout)
+	}
+
+	related := "start"
+	if a.FromDue {
+		related = "due"
+	}
+	switch {
+	case a.Offset < 0:
+		return fmt.Sprintf("%s before %s", formatAlarmDuration(-a.Offset), related)
+	case a.Offset > 0:
+		return fmt.Sprintf("%s after %s", formatAlarmDuration(a.Offset), related)
+	default:
+		return fmt.Sprintf("at %s", related)
+	}
+}
+
+// ParseAlarm parses an alarm relative to todo due date or start, such as
+// '1h before', '2 days before due', '30m after start' or 'at due',
+// or an absolute alarm time such as '2 Jan 2006 15:04'.
+// Relative alarms are related to due date unless start is given.
+func ParseAlarm(s string) (Alarm, error) {
+	s = strings.TrimSpace(s)
+
+	if at, err := time.ParseInLocation(alarmLayout, s, DisplayLocation()); err == nil {
+		return Alarm{At: at}, nil
+	}
+
+	m := alarmRelativeRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return Alarm{}, fmt.Errorf("Invalid reminder: %q", s)
+	}
+
+	a := Alarm{FromDue: !strings.EqualFold(m[3], "start")}
+	if m[1] != "" {
+		d, err := parseAlarmDuration(m[1])
+		if err != nil {
+			return Alarm{}, fmt.Errorf("Invalid reminder: %q", s)
+		}
+		a.Offset = d
+		if strings.EqualFold(m[2], "before") {
+			a.Offset = -d
+		}
+	}
+	return a, nil
+}
+
+// parseAlarmDuration parses a duration such as '1h', '1h30m', '2 days' or '30s'
+func parseAlarmDuration(s string) (d time.Duration, err error) {
+	rest := strings.TrimSpace(s)
+	for _, m := range alarmDurationRegexp.FindAllStringSubmatch(s, -1) {
+		rest = strings.TrimSpace(strings.Replace(rest, m[0], "", 1))
+		n, _ := strconv.Atoi(m[1])
+		switch unit := strings.ToLower(m[2]); {
+		case strings.HasPrefix(unit, "w"):
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case strings.HasPrefix(unit, "d"):
+			d += time.Duration(n) * 24 * time.Hour
+		case strings.HasPrefix(unit, "h"):
+			d += time.Duration(n) * time.Hour
+		case strings.HasPrefix(unit, "s"):
+			d += time.Duration(n) * time.Second
+		default:
+			d += time.Duration(n) * time.Minute
+		}
+	}
+	if rest != "" || d == 0 {
+		return 0, fmt.Errorf("Invalid duration: %q", s)
+	}
+	return d, nil
+}
+
+// formatAlarmDuration returns a short duration such as '1w', '2d', '1h30m'
+// or '30s' for offsets that aren't whole minutes
+func formatAlarmDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%(7*day) == 0 {
+		return fmt.Sprintf("%dw", d/(7*day))
+	}
+
+	sb := strings.Builder{}
+	for _, u := range []struct {
+		unit time.Duration
+		name string
+	}{{day, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / u.unit; n > 0 {
+			sb.WriteString(fmt.Sprintf("%d%s", n, u.name))
+			d -= n * u.unit
+		}
+	}
+	return sb.String()
+}
+
+// formatICalDuration returns d as an RFC 5545 duration value, e.g. -PT1H
+func formatICalDuration(d time.Duration) string {
+	const day = 24 * time.Hour
+
+	sb := strings.Builder{}
+	if d < 0 {
+		sb.WriteString("-")
+		d = -d
+	}
+	sb.WriteString("P")
+	if d != 0 && d%(7*day) == 0 {
+		sb.WriteString(fmt.Sprintf("%dW", d/(7*day)))
+		return sb.String()
+	}
+	if n := d / day; n > 0 {
+		sb.WriteString(fmt.Sprintf("%dD", n))
+		d -= n * day
+	}
+	if d > 0 || sb.Len() <= 2 {
+		sb.WriteString("T")
+		h, m, s := d/time.Hour, (d%time.Hour)/time.Minute, (d%time.Minute)/time.Second
+		if h > 0 {
+			sb.WriteString(fmt.Sprintf("%dH", h))
+		}
+		if m > 0 {
+			sb.WriteString(fmt.Sprintf("%dM", m))
+		}
+		if s > 0 || h == 0 && m == 0 {
+			sb.WriteString(fmt.Sprintf("%dS", s))
+		}
+	}
+	return sb.String()
+}
+
+// parseAlarm returns alarm of a VALARM component
+func parseAlarm(cal *ical.Calendar, comp *ical.Component) (Alarm, error) {
+	prop := comp.Props.Get(ical.PropTrigger)
+	if prop == nil {
+		return Alarm{}, fmt.Errorf("Alarm without trigger")
+	}
+
+	if prop.ValueType() == ical.ValueDateTime {
+		at, _, err := ParseDateTime(cal, prop)
+		return Alarm{At: at}, err
+	}
+
+	d, err := prop.Duration()
+	if err != nil {
+		return Alarm{}, err
+	}
+	related := strings.ToUpper(prop.Params.Get(ical.ParamRelated))
+	return Alarm{Offset: d, FromDue: related == "END"}, nil
+}
+
+// newAlarmComponent returns a display VALARM component for alarm
+func newAlarmComponent(a Alarm, description string) *ical.Component {
+	comp := ical.NewComponent(ical.CompAlarm)
+	comp.Props.SetText(ical.PropAction, "DISPLAY")
+	if description == "" {
+		description = "Reminder"
+	}
+	comp.Props.SetText(ical.PropDescription, description)
+
+	trigger := ical.NewProp(ical.PropTrigger)
+	if a.IsRelative() {
+		trigger.Value = formatICalDuration(a.Offset)
+		if a.FromDue {
+			trigger.Params.Set(ical.ParamRelated, "END")
+		}
+	} else {
+		trigger.SetDateTime(a.At.UTC())
+	}
+	comp.Props.Set(trigger)
+	return comp
+}
+
+// equal reports whether alarms trigger at the same time
+func (a Alarm) equal(b Alarm) bool {
+	if a.IsRelative() != b.IsRelative() {
+		return false
+	}
+	if !a.IsRelative() {
+		return a.At.Equal(b.At)
+	}
+	return a.Offset == b.Offset && a.FromDue == b.FromDue
+}
+
+// Alarms returns todo alarms, alarms that can't be parsed are skipped
+func (t *Todo) Alarms() (alarms []Alarm) {
+	for _, comp := range t.Children {
+		if comp.Name != ical.CompAlarm {
+			continue
+		}
+		if a, err := parseAlarm(t.cal, comp); err == nil {
+			alarms = append(alarms, a)
+		}
+	}
+	return
+}
+
+// SetAlarms replaces todo alarms. Existing VALARM components matching
+// one of alarms are kept as they are, new ones are display alarms.
+func (t *Todo) SetAlarms(alarms []Alarm) {
+	var (
+		children []*ical.Component
+		kept     = make([]bool, len(alarms))
+	)
+	for _, comp := range t.Children {
+		if comp.Name != ical.CompAlarm {
+			children = append(children, comp)
+			continue
+		}
+		a, err := parseAlarm(t.cal, comp)
+		if err != nil {
+			// keep alarms tdx doesn't understand
+			children = append(children, comp)
+			continue
+		}
+		for n, want := range alarms {
+			if !kept[n] && want.equal(a) {
+				kept[n] = true
+				children = append(children, comp)
+				break
+			}
+		}
+	}
+	for n, a := range alarms {
+		if !kept[n] {
+			children = append(children, newAlarmComponent(a, t.Summary()))
+		}
+	}
+	t.Children = children
+}
+
+// AddAlarm adds an alarm to todo
+func (t *Todo) AddAlarm(a Alarm) {
+	t.SetAlarms(append(t.Alarms(), a))
+}
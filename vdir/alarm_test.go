@@ -0,0 +1,109 @@
+package vdir
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+func TestParseAlarm(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want Alarm
+		str  string
+	}{
+		{"1h before", Alarm{Offset: -time.Hour, FromDue: true}, "1h before due"},
+		{"2 days before due", Alarm{Offset: -48 * time.Hour, FromDue: true}, "2d before due"},
+		{"1h30m after start", Alarm{Offset: 90 * time.Minute}, "1h30m after start"},
+		{"1 week before", Alarm{Offset: -7 * 24 * time.Hour, FromDue: true}, "1w before due"},
+		{"at start", Alarm{}, "at start"},
+		{"30s before", Alarm{Offset: -30 * time.Second, FromDue: true}, "30s before due"},
+		{"1 minute 30 seconds after due", Alarm{Offset: 90 * time.Second, FromDue: true}, "1m30s after due"},
+		{"19 Oct 2026 09:00", Alarm{At: time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)}, "19 Oct 2026 09:00"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlarm(tt.in)
+		if err != nil {
+			t.Errorf("ParseAlarm(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !got.equal(tt.want) {
+			t.Errorf("ParseAlarm(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if got.String() != tt.str {
+			t.Errorf("String() = %q, want %q", got.String(), tt.str)
+		}
+	}
+
+	for _, s := range []string{"", "soon", "1 fortnight before", "0m before"} {
+		if _, err := ParseAlarm(s); err == nil {
+			t.Errorf("ParseAlarm(%q) succeeded, want error", s)
+		}
+	}
+}
+
+func TestFormatICalDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		-time.Hour:                 "-PT1H",
+		26*time.Hour + time.Minute: "P1DT2H1M",
+		14 * 24 * time.Hour:        "P2W",
+		0:                          "PT0S",
+	} {
+		if got := formatICalDuration(d); got != want {
+			t.Errorf("formatICalDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestSetAlarms(t *testing.T) {
+	const data = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTODO
+UID:1
+DTSTAMP:20210701T000000Z
+DUE:20210715T100000Z
+BEGIN:VALARM
+ACTION:AUDIO
+X-WR-ALARMUID:kept
+TRIGGER;RELATED=END:-PT1H
+END:VALARM
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:removed
+TRIGGER;VALUE=DATE-TIME:20210715T080000Z
+END:VALARM
+END:VTODO
+END:VCALENDAR
+`
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := &Todo{cal.Children[0], cal}
+
+	if n := len(todo.Alarms()); n != 2 {
+		t.Fatalf("Alarms() returned %d alarms, want 2", n)
+	}
+	if at, ok := todo.Alarms()[0].Time(todo); !ok || !at.Equal(time.Date(2021, 7, 15, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Time() = %v, %t", at, ok)
+	}
+
+	todo.SetAlarms([]Alarm{
+		{Offset: -time.Hour, FromDue: true},
+		{Offset: -15 * time.Minute},
+	})
+
+	alarms := todo.Children
+	if len(alarms) != 2 {
+		t.Fatalf("todo has %d alarms, want 2", len(alarms))
+	}
+	if v, _ := alarms[0].Props.Text("X-WR-ALARMUID"); v != "kept" {
+		t.Errorf("matching alarm was replaced")
+	}
+	if v := alarms[1].Props.Get(ical.PropTrigger).Value; v != "-PT15M" {
+		t.Errorf("TRIGGER = %q, want %q", v, "-PT15M")
+	}
+}
@@ -0,0 +1,178 @@
+package vdir
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// CacheFile is a filename tdx uses to cache todo metadata inside vdir
+const CacheFile = ".tdx-index"
+
+// cacheVersion must be bumped whenever itemMeta fields change
+const cacheVersion = 14
+
+// itemMeta holds todo fields needed for filtering, sorting and ID assignment
+type itemMeta struct {
+	UID          string     `json:"uid"`
+	RecurrenceID string     `json:"recurrenceId"`
+	Status       ToDoStatus `json:"status"`
+	Summary      string     `json:"summary"`
+	Due          time.Time  `json:"due"`
+	DueAllDay    bool       `json:"dueAllDay"`
+	Start        time.Time  `json:"start"`
+	StartAllDay  bool       `json:"startAllDay"`
+	Created      time.Time  `json:"created"`
+	Priority     int        `json:"priority"`
+	Tags         []Tag      `json:"tags"`
+	Parent       string     `json:"parent"`
+	Percent      int        `json:"percent"`
+	DependsOn    []string   `json:"dependsOn"`
+	Alarms       []Alarm    `json:"alarms"`
+}
+
+// cacheEntry is a cached state of a single item file
+type cacheEntry struct {
+	ModTime time.Time   `json:"modTime"`
+	Size    int64       `json:"size"`
+	Todos   []*itemMeta `json:"todos"`
+}
+
+// itemCache is an on-disk cache of todo metadata keyed by file path
+type itemCache struct {
+	path      string
+	root      string
+	Version   int                    `json:"version"`
+	TagSyntax string                 `json:"tagSyntax"` // tags are cached as parsed with this syntax
+	Entries   map[string]*cacheEntry `json:"entries"`
+	changed   bool
+}
+
+// newItemMeta returns metadata of todo
+func newItemMeta(t *Todo) *itemMeta {
+	m := &itemMeta{
+		UID:       t.UID(),
+		Status:    t.Status(),
+		Summary:   t.Summary(),
+		Created:   t.Created(),
+		Priority:  int(t.Priority()),
+		Tags:      t.Tags(),
+		Parent:    t.Parent(),
+		Percent:   t.PercentComplete(),
+		DependsOn: t.Dependencies(),
+		Alarms:    t.Alarms(),
+	}
+	if p := t.Props.Get(ical.PropRecurrenceID); p != nil {
+		m.RecurrenceID = p.Value
+	}
+	m.Due, m.DueAllDay = t.Due()
+	m.Start, m.StartAllDay = t.Start()
+	return m
+}
+
+// loadCache reads a metadata cache for vdir at root. A missing, outdated or
+// malformed cache file results in an empty cache that is rebuilt on save.
+func loadCache(root string) *itemCache {
+	c := &itemCache{
+		path:      filepath.Join(root, CacheFile),
+		root:      root,
+		Version:   cacheVersion,
+		TagSyntax: tagSyntax(),
+		Entries:   make(map[string]*cacheEntry),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c
+	} else if err != nil {
+		log.Println(err)
+		return c
+	}
+
+	loaded := itemCache{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Printf("Ignoring malformed cache: %s (%s)", err, c.path)
+		c.changed = true
+		return c
+	}
+	if loaded.Version != cacheVersion || loaded.TagSyntax != c.TagSyntax || loaded.Entries == nil {
+		c.changed = true
+		return c
+	}
+	c.Entries = loaded.Entries
+
+	// all-day dates are local midnights, which depend on current timezone
+	for _, e := range c.Entries {
+		for _, m := range e.Todos {
+			if m.DueAllDay {
+				y, mon, d := m.Due.Date()
+				m.Due = time.Date(y, mon, d, 0, 0, 0, 0, time.Local)
+			}
+			if m.StartAllDay {
+				y, mon, d := m.Start.Date()
+				m.Start = time.Date(y, mon, d, 0, 0, 0, 0, time.Local)
+			}
+		}
+	}
+
+	return c
+}
+
+// key returns a cache key for item path
+func (c *itemCache) key(path string) string {
+	if rel, err := filepath.Rel(c.root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// get returns a cache entry for path if it's still fresh
+func (c *itemCache) get(path string, info fs.FileInfo) (*cacheEntry, bool) {
+	e, ok := c.Entries[c.key(path)]
+	if !ok || !e.ModTime.Equal(info.ModTime()) || e.Size != info.Size() {
+		return nil, false
+	}
+	return e, true
+}
+
+// put stores a cache entry for path
+func (c *itemCache) put(path string, modTime time.Time, size int64, todos []*itemMeta) {
+	c.Entries[c.key(path)] = &cacheEntry{modTime, size, todos}
+	c.changed = true
+}
+
+// prune removes entries for files that are not in paths
+func (c *itemCache) prune(paths []string) {
+	present := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		present[c.key(p)] = true
+	}
+	for k := range c.Entries {
+		if !present[k] {
+			delete(c.Entries, k)
+			c.changed = true
+		}
+	}
+}
+
+// save writes the cache to disk if it was changed
+func (c *itemCache) save() error {
+	if !c.changed {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, data, 0644); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
@@ -0,0 +1,296 @@
+package vdir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const (
+	icalDate        = "20060102"
+	icalDateTime    = "20060102T150405"
+	icalDateTimeUTC = "20060102T150405Z"
+)
+
+// displayLocation is a timezone dates are shown in, local time if nil
+var displayLocation *time.Location
+
+// SetDisplayLocation sets a timezone dates are shown and entered in.
+// Floating and all-day dates are still read in local time.
+func SetDisplayLocation(loc *time.Location) {
+	displayLocation = loc
+}
+
+// DisplayLocation returns a timezone dates are shown and entered in
+func DisplayLocation() *time.Location {
+	if displayLocation == nil {
+		return time.Local
+	}
+	return displayLocation
+}
+
+// ParseDateTime parses a DATE or DATE-TIME prop value. Dates without time are
+// returned as local midnight with allDay set. Times with TZID are resolved through
+// the IANA database or the VTIMEZONE component in cal, floating times are local.
+func ParseDateTime(cal *ical.Calendar, prop *ical.Prop) (t time.Time, allDay bool, err error) {
+	if prop == nil || prop.Value == "" {
+		return
+	}
+
+	value := strings.TrimSpace(prop.Value)
+
+	if prop.ValueType() == ical.ValueDate || len(value) == len(icalDate) {
+		t, err = time.ParseInLocation(icalDate, value, time.Local)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(icalDateTimeUTC, value)
+		return
+	}
+
+	tzid := prop.Params.Get(ical.ParamTimezoneID)
+	if tzid == "" {
+		t, err = time.ParseInLocation(icalDateTime, value, time.Local)
+		return
+	}
+
+	loc, err := resolveTimezone(cal, tzid, value)
+	if err != nil {
+		return
+	}
+	t, err = time.ParseInLocation(icalDateTime, value, loc)
+	return
+}
+
+// NewDateTimeProp returns a prop with t as value, all-day dates are stored
+// as VALUE=DATE and other times in UTC
+func NewDateTimeProp(name string, t time.Time, allDay bool) *ical.Prop {
+	prop := ical.NewProp(name)
+	if allDay {
+		prop.SetValueType(ical.ValueDate)
+		prop.Value = t.Format(icalDate)
+	} else {
+		prop.SetDateTime(t.UTC())
+	}
+	return prop
+}
+
+// resolveTimezone returns a location for tzid, local is a wall clock value
+// used to pick an offset from VTIMEZONE definitions
+func resolveTimezone(cal *ical.Calendar, tzid string, local string) (*time.Location, error) {
+	if tzid == "Local" {
+		return time.Local, nil
+	}
+	// some clients prefix IANA names, e.g. /mozilla.org/20050126_1/Europe/Berlin
+	for name := tzid; name != ""; {
+		if loc, err := time.LoadLocation(strings.TrimPrefix(name, "/")); err == nil {
+			return loc, nil
+		}
+		i := strings.Index(strings.TrimPrefix(name, "/"), "/")
+		if i < 0 {
+			break
+		}
+		name = strings.TrimPrefix(name, "/")[i+1:]
+	}
+
+	if cal != nil {
+		for _, comp := range cal.Children {
+			if comp.Name != ical.CompTimezone {
+				continue
+			}
+			if id, _ := comp.Props.Text(ical.PropTimezoneID); id != tzid {
+				continue
+			}
+			wall, err := time.Parse(icalDateTime, local)
+			if err != nil {
+				return nil, err
+			}
+			offset, err := vtimezoneOffset(comp, wall)
+			if err != nil {
+				return nil, err
+			}
+			return time.FixedZone(tzid, offset), nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown timezone: %q", tzid)
+}
+
+// vtimezoneOffset returns UTC offset in seconds of VTIMEZONE tz at wall clock time,
+// the offset of the latest observance that started before wall is used
+func vtimezoneOffset(tz *ical.Component, wall time.Time) (int, error) {
+	var (
+		latest time.Time
+		offset int
+		found  bool
+	)
+
+	for _, obs := range tz.Children {
+		if obs.Name != ical.CompTimezoneStandard && obs.Name != ical.CompTimezoneDaylight {
+			continue
+		}
+		dtstart := obs.Props.Get(ical.PropDateTimeStart)
+		if dtstart == nil {
+			id, _ := tz.Props.Text(ical.PropTimezoneID)
+			return 0, fmt.Errorf("Missing timezone observance start: %q", id)
+		}
+		start, err := time.Parse(icalDateTime, dtstart.Value)
+		if err != nil {
+			return 0, err
+		}
+		to, err := parseUTCOffset(obs.Props.Get(ical.PropTimezoneOffsetTo))
+		if err != nil {
+			return 0, err
+		}
+
+		onset := start
+		if rrule := obs.Props.Get(ical.PropRecurrenceRule); rrule != nil {
+			onset = yearlyOnset(rrule.Value, start, wall)
+		}
+		if onset.IsZero() || onset.After(wall) {
+			continue
+		}
+		if !found || onset.After(latest) {
+			latest, offset, found = onset, to, true
+		}
+	}
+
+	if !found {
+		// wall is before any observance, use the earliest offset
+		for _, obs := range tz.Children {
+			if p := obs.Props.Get(ical.PropTimezoneOffsetFrom); p != nil {
+				return parseUTCOffset(p)
+			}
+		}
+		return 0, fmt.Errorf("No timezone observances found")
+	}
+	return offset, nil
+}
+
+// yearlyOnset returns the latest onset of a yearly timezone rule, such as
+// FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU, that is not after wall
+func yearlyOnset(rule string, start, wall time.Time) time.Time {
+	var (
+		month time.Month
+		nth   int
+		day   time.Weekday
+		ok    bool
+	)
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "FREQ":
+			if kv[1] != "YEARLY" {
+				return time.Time{}
+			}
+		case "BYMONTH":
+			m, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return time.Time{}
+			}
+			month = time.Month(m)
+		case "BYDAY":
+			nth, day, ok = parseByDay(kv[1])
+			if !ok {
+				return time.Time{}
+			}
+		}
+	}
+	if month == 0 || !ok {
+		return time.Time{}
+	}
+
+	for year := wall.Year(); year >= wall.Year()-1; year-- {
+		onset := nthWeekday(year, month, nth, day)
+		onset = onset.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+		if !onset.After(wall) && !onset.Before(start) {
+			return onset
+		}
+	}
+	return time.Time{}
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// parseByDay parses a BYDAY value with an optional ordinal, e.g. 2SU or -1SU
+func parseByDay(s string) (nth int, day time.Weekday, ok bool) {
+	if len(s) < 2 {
+		return
+	}
+	day, ok = weekdays[s[len(s)-2:]]
+	if !ok {
+		return
+	}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil {
+			return 0, day, false
+		}
+		nth = n
+	}
+	return
+}
+
+// nthWeekday returns nth weekday of month, negative nth counts from the end of month
+func nthWeekday(year int, month time.Month, nth int, day time.Weekday) time.Time {
+	if nth < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		diff := (int(last.Weekday()) - int(day) + 7) % 7
+		return last.AddDate(0, 0, -diff+7*(nth+1))
+	}
+	if nth == 0 {
+		nth = 1
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	diff := (int(day) - int(first.Weekday()) + 7) % 7
+	return first.AddDate(0, 0, diff+7*(nth-1))
+}
+
+// parseUTCOffset parses an UTC-OFFSET value such as -0500 into seconds
+func parseUTCOffset(prop *ical.Prop) (int, error) {
+	if prop == nil {
+		return 0, fmt.Errorf("Missing UTC offset")
+	}
+	v := strings.TrimSpace(prop.Value)
+	if len(v) != 5 && len(v) != 7 {
+		return 0, fmt.Errorf("Invalid UTC offset: %q", v)
+	}
+	sign := 1
+	switch v[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return 0, fmt.Errorf("Invalid UTC offset: %q", v)
+	}
+	h, err := strconv.Atoi(v[1:3])
+	if err != nil {
+		return 0, fmt.Errorf("Invalid UTC offset: %q", v)
+	}
+	m, err := strconv.Atoi(v[3:5])
+	if err != nil {
+		return 0, fmt.Errorf("Invalid UTC offset: %q", v)
+	}
+	s := 0
+	if len(v) == 7 {
+		if s, err = strconv.Atoi(v[5:7]); err != nil {
+			return 0, fmt.Errorf("Invalid UTC offset: %q", v)
+		}
+	}
+	return sign * (h*3600 + m*60 + s), nil
+}
@@ -0,0 +1,133 @@
+package vdir
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const tzCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTIMEZONE
+TZID:Custom Eastern
+BEGIN:STANDARD
+DTSTART:19701101T020000
+RRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:19700308T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU
+TZOFFSETFROM:-0500
+TZOFFSETTO:-0400
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VTODO
+UID:1
+DUE;TZID=Custom Eastern:20210715T090000
+DTSTART;TZID=Custom Eastern:20210115T090000
+END:VTODO
+END:VCALENDAR
+`
+
+func TestParseDateTime(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(tzCalendar)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vtodo := cal.Children[1]
+
+	newProp := func(value string, params ...string) *ical.Prop {
+		p := ical.NewProp(ical.PropDue)
+		p.Value = value
+		for i := 0; i+1 < len(params); i += 2 {
+			p.Params.Set(params[i], params[i+1])
+		}
+		return p
+	}
+
+	var tests = []struct {
+		name   string
+		prop   *ical.Prop
+		want   time.Time
+		allDay bool
+	}{
+		{"date", newProp("20210715", ical.ParamValue, "DATE"), time.Date(2021, 7, 15, 0, 0, 0, 0, time.Local), true},
+		{"date without value type", newProp("20210715"), time.Date(2021, 7, 15, 0, 0, 0, 0, time.Local), true},
+		{"utc", newProp("20210715T090000Z"), time.Date(2021, 7, 15, 9, 0, 0, 0, time.UTC), false},
+		{"floating", newProp("20210715T090000"), time.Date(2021, 7, 15, 9, 0, 0, 0, time.Local), false},
+		{"iana", newProp("20210715T090000", ical.ParamTimezoneID, "Europe/Berlin"), time.Date(2021, 7, 15, 7, 0, 0, 0, time.UTC), false},
+		{"vtimezone daylight", vtodo.Props.Get(ical.PropDue), time.Date(2021, 7, 15, 13, 0, 0, 0, time.UTC), false},
+		{"vtimezone standard", vtodo.Props.Get(ical.PropDateTimeStart), time.Date(2021, 1, 15, 14, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, allDay, err := ParseDateTime(cal, tt.prop)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) || allDay != tt.allDay {
+				t.Errorf("ParseDateTime() = %v, %t, want %v, %t", got, allDay, tt.want, tt.allDay)
+			}
+		})
+	}
+}
+
+func TestNewDateTimeProp(t *testing.T) {
+	d := time.Date(2021, 7, 15, 0, 0, 0, 0, time.Local)
+
+	p := NewDateTimeProp(ical.PropDue, d, true)
+	if p.Value != "20210715" || p.ValueType() != ical.ValueDate {
+		t.Errorf("all-day prop = %q (%s), want %q (%s)", p.Value, p.ValueType(), "20210715", ical.ValueDate)
+	}
+
+	p = NewDateTimeProp(ical.PropDue, d, false)
+	if got, _, _ := ParseDateTime(nil, p); !got.Equal(d) || p.Params.Get(ical.ParamTimezoneID) != "" {
+		t.Errorf("date-time prop = %q %v, want UTC value of %v", p.Value, p.Params, d)
+	}
+}
+
+func TestParseDateTimeMissingObservanceStart(t *testing.T) {
+	data := strings.Replace(tzCalendar, "DTSTART:19701101T020000\n", "", 1)
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseDateTime(cal, cal.Children[1].Props.Get(ical.PropDue)); err == nil {
+		t.Error("ParseDateTime(): want error for observance without DTSTART")
+	}
+}
+
+func TestDisplayLocation(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	SetDisplayLocation(loc)
+	defer SetDisplayLocation(nil)
+
+	// floating and all-day dates are read in local time
+	for _, value := range []string{"20210715", "20210715T090000"} {
+		p := ical.NewProp(ical.PropDue)
+		p.Value = value
+		got, _, err := ParseDateTime(nil, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Location() != time.Local {
+			t.Errorf("ParseDateTime(%q) location = %v, want local", value, got.Location())
+		}
+	}
+
+	a, err := ParseAlarm("15 Jul 2021 09:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2021, 7, 15, 9, 0, 0, 0, loc); !a.At.Equal(want) || a.String() != "15 Jul 2021 09:00" {
+		t.Errorf("ParseAlarm() = %v (%s), want %v", a.At, a, want)
+	}
+}
@@ -0,0 +1,73 @@
+package vdir
+
+// Dependencies returns todos item depends on, missing todos are skipped
+func (v *Vdir) Dependencies(item *Item) (deps []*Item) {
+	m, err := item.metadata()
+	if err != nil {
+		return nil
+	}
+	for _, uid := range m.DependsOn {
+		if dep, err := v.ItemByUID(uid); err == nil {
+			deps = append(deps, dep)
+		}
+	}
+	return
+}
+
+// Blockers returns open todos item depends on
+func (v *Vdir) Blockers(item *Item) (blockers []*Item) {
+	for _, dep := range v.Dependencies(item) {
+		m, err := dep.metadata()
+		if err != nil {
+			continue
+		}
+		if m.Status == StatusNeedsAction || m.Status == StatusInProcess {
+			blockers = append(blockers, dep)
+		}
+	}
+	return
+}
+
+// RefreshBlockers finds open todos item depends on again and keeps them
+// with the item for filtering and formatting, e.g. after a dependency changed
+func (v *Vdir) RefreshBlockers(item *Item) {
+	item.blockers = v.Blockers(item)
+}
+
+// DependencyCycle returns todos that would form a cycle if item depended
+// on dep, starting and ending with item, or nil if there is no cycle
+func (v *Vdir) DependencyCycle(item, dep *Item) []*Item {
+	if item == dep {
+		return []*Item{item, item}
+	}
+
+	// search for a path from dep back to item
+	prev := map[*Item]*Item{dep: nil}
+	queue := []*Item{dep}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, d := range v.Dependencies(cur) {
+			if _, ok := prev[d]; ok {
+				continue
+			}
+			prev[d] = cur
+			if d != item {
+				queue = append(queue, d)
+				continue
+			}
+
+			var path []*Item
+			for i := item; i != nil; i = prev[i] {
+				path = append([]*Item{i}, path...)
+			}
+			return append([]*Item{item}, path...)
+		}
+	}
+	return nil
+}
+
+// Blockers returns open todos the item depends on, as found by Vdir.RefreshBlockers
+func (i *Item) Blockers() []*Item {
+	return i.blockers
+}
@@ -0,0 +1,82 @@
+package vdir
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDependencies(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{UID: "design", Status: StatusCompleted},
+		testTodo{UID: "build", Status: StatusNeedsAction, DependsOn: []string{"design"}},
+		testTodo{UID: "test", Status: StatusNeedsAction, DependsOn: []string{"build", "design", "missing"}},
+		testTodo{UID: "ship", Status: StatusNeedsAction, DependsOn: []string{"test"}},
+	)
+	items := v.Items()
+	design, build, test, ship := items[0], items[1], items[2], items[3]
+
+	setStatus := func(item *Item, status ToDoStatus) {
+		err := item.Update(func(i *Item) error {
+			t, err := i.Todo()
+			if err != nil {
+				return err
+			}
+			t.SetStatus(status)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(items []*Item) (ids []int) {
+		for _, i := range items {
+			ids = append(ids, i.Id)
+		}
+		return
+	}
+
+	if diff := cmp.Diff([]int{2}, ids(test.Blockers())); diff != "" {
+		t.Errorf("Blockers() mismatch (-want +got):\n%s", diff)
+	}
+	if len(build.Blockers()) != 0 {
+		t.Errorf("Blockers() = %v, want none for todo with completed dependency", ids(build.Blockers()))
+	}
+
+	// blockers kept with the item change only when refreshed
+	setStatus(build, StatusCompleted)
+	if diff := cmp.Diff([]int{2}, ids(test.Blockers())); diff != "" {
+		t.Errorf("Blockers() before refresh mismatch (-want +got):\n%s", diff)
+	}
+	v.RefreshBlockers(test)
+	if len(test.Blockers()) != 0 {
+		t.Errorf("Blockers() = %v, want none after dependencies were completed", ids(test.Blockers()))
+	}
+	setStatus(build, StatusNeedsAction)
+
+	if diff := cmp.Diff([]int{1, 4, 3, 1}, ids(v.DependencyCycle(design, ship))); diff != "" {
+		t.Errorf("DependencyCycle() mismatch (-want +got):\n%s", diff)
+	}
+	if cycle := v.DependencyCycle(ship, design); cycle != nil {
+		t.Errorf("DependencyCycle() = %v, want no cycle", ids(cycle))
+	}
+}
+
+func TestTodoDependencies(t *testing.T) {
+	todo := NewTodo()
+	todo.SetParent("parent")
+	todo.AddDependency("a")
+	todo.AddDependency("b")
+	todo.AddDependency("a")
+
+	if diff := cmp.Diff([]string{"a", "b"}, todo.Dependencies()); diff != "" {
+		t.Errorf("Dependencies() mismatch (-want +got):\n%s", diff)
+	}
+	if !todo.RemoveDependency("a") || todo.RemoveDependency("a") {
+		t.Error("RemoveDependency() must remove an existing dependency once")
+	}
+	if todo.Parent() != "parent" {
+		t.Errorf("Parent() = %q, want parent relation kept", todo.Parent())
+	}
+}
@@ -3,8 +3,6 @@ package vdir
 import (
 	"strings"
 	"time"
-
-	"github.com/emersion/go-ical"
 )
 
 type (
@@ -13,39 +11,44 @@ type (
 	ByDue          []*Item
 	ByStatus       []*Item
 	ByCreated      []*Item
+	ByProgress     []*Item
 	ByTags         []*Item
 	ByTagsExcluded []*Item
+	ByParent       []*Item
+	ByTopLevel     []*Item
+	ByBlocked      []*Item
+	ByActionable   []*Item
+	ByStart        []*Item
 )
 
 // Filter
 
 type filter interface {
 	Items() []*Item
-	Keep(item Item, i interface{}) (bool, error)
+	Keep(item *Item, i interface{}) (bool, error)
 }
 
 func (f ByStatus) Items() []*Item { return f }
-func (f ByStatus) Keep(item Item, i interface{}) (bool, error) {
+func (f ByStatus) Keep(item *Item, i interface{}) (bool, error) {
 	status := i.(ToDoStatus)
 	if status.String() == StatusAny.String() {
 		return true, nil
 	}
 
-	vt, err := item.Vtodo()
+	m, err := item.metadata()
 	if err != nil {
 		return false, err
 	}
 
-	st, err := vt.Props.Text(ical.PropStatus)
-	if err != nil {
-		return false, err
+	if status.String() == StatusOpen.String() {
+		return m.Status == StatusNeedsAction || m.Status == StatusInProcess, nil
 	}
 
-	return status.String() == ToDoStatus(st).String(), nil
+	return status.String() == m.Status.String(), nil
 }
 
 func (f ByTags) Items() []*Item { return f }
-func (f ByTags) Keep(item Item, i interface{}) (bool, error) {
+func (f ByTags) Keep(item *Item, i interface{}) (bool, error) {
 	tags := i.([]Tag)
 	if len(tags) == 0 {
 		return true, nil
@@ -63,7 +66,7 @@ func (f ByTags) Keep(item Item, i interface{}) (bool, error) {
 }
 
 func (f ByTagsExcluded) Items() []*Item { return f }
-func (f ByTagsExcluded) Keep(item Item, i interface{}) (bool, error) {
+func (f ByTagsExcluded) Keep(item *Item, i interface{}) (bool, error) {
 	tags := i.([]Tag)
 	if len(tags) == 0 {
 		return true, nil
@@ -82,7 +85,7 @@ func (f ByTagsExcluded) Keep(item Item, i interface{}) (bool, error) {
 }
 
 func (f ByDue) Items() []*Item { return f }
-func (f ByDue) Keep(item Item, i interface{}) (bool, error) {
+func (f ByDue) Keep(item *Item, i interface{}) (bool, error) {
 	dueDays := i.(int)
 	if dueDays == 0 {
 		return true, nil
@@ -91,48 +94,119 @@ func (f ByDue) Keep(item Item, i interface{}) (bool, error) {
 	now := time.Now()
 	inDueDays := now.AddDate(0, 0, dueDays)
 
-	vt, err := item.Vtodo()
+	m, err := item.metadata()
 	if err != nil {
 		return false, err
 	}
 
-	due, err := vt.Props.DateTime(ical.PropDue, time.Local)
+	if due := m.Due; !due.IsZero() && due.Before(inDueDays) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f ByPriority) Items() []*Item { return f }
+func (f ByPriority) Keep(item *Item, i interface{}) (bool, error) {
+	r := i.(PriorityRange)
+
+	m, err := item.metadata()
 	if err != nil {
 		return false, err
 	}
 
-	if !due.IsZero() && due.Before(inDueDays) {
-		return true, nil
-	}
-	return false, nil
+	return r.Contains(ToDoPriority(m.Priority)), nil
 }
 
 func (f ByText) Items() []*Item { return f }
-func (f ByText) Keep(item Item, i interface{}) (bool, error) {
+func (f ByText) Keep(item *Item, i interface{}) (bool, error) {
 	text := i.(string)
 	if text == "" {
 		return true, nil
 	}
 
-	vt, err := item.Vtodo()
+	m, err := item.metadata()
 	if err != nil {
 		return false, err
 	}
 
-	summary, err := vt.Props.Text(ical.PropSummary)
+	if strings.Contains(strings.ToLower(m.Summary), strings.ToLower(text)) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f ByParent) Items() []*Item { return f }
+func (f ByParent) Keep(item *Item, i interface{}) (bool, error) {
+	parents := i.([]string)
+	if len(parents) == 0 {
+		return true, nil
+	}
+
+	m, err := item.metadata()
 	if err != nil {
 		return false, err
 	}
 
-	if strings.Contains(strings.ToLower(summary), strings.ToLower(text)) {
-		return true, nil
+	for _, uid := range parents {
+		if m.Parent == uid {
+			return true, nil
+		}
 	}
 	return false, nil
 }
 
+func (f ByTopLevel) Items() []*Item { return f }
+func (f ByTopLevel) Keep(item *Item, i interface{}) (bool, error) {
+	if topLevel := i.(bool); !topLevel {
+		return true, nil
+	}
+
+	m, err := item.metadata()
+	if err != nil {
+		return false, err
+	}
+
+	return m.Parent == "", nil
+}
+
+func (f ByBlocked) Items() []*Item { return f }
+func (f ByBlocked) Keep(item *Item, i interface{}) (bool, error) {
+	if blocked := i.(bool); !blocked {
+		return true, nil
+	}
+	return len(item.blockers) > 0, nil
+}
+
+func (f ByActionable) Items() []*Item { return f }
+func (f ByActionable) Keep(item *Item, i interface{}) (bool, error) {
+	if actionable := i.(bool); !actionable {
+		return true, nil
+	}
+	return len(item.blockers) == 0, nil
+}
+
+func (f ByStart) Items() []*Item { return f }
+
+// Keep keeps todos that start by given time. Todos without start date and
+// todos that are already started or closed are always kept, a zero time
+// keeps all todos.
+func (f ByStart) Keep(item *Item, i interface{}) (bool, error) {
+	t := i.(time.Time)
+	if t.IsZero() {
+		return true, nil
+	}
+
+	m, err := item.metadata()
+	if err != nil {
+		return false, err
+	}
+
+	return m.Status != StatusNeedsAction || m.Start.IsZero() || !m.Start.After(t), nil
+}
+
 func Filter(f filter, i interface{}) (filtered []*Item, err error) {
 	for _, item := range f.Items() {
-		keep, err := f.Keep(*item, i)
+		keep, err := f.Keep(item, i)
 		if err != nil {
 			return filtered, err
 		}
@@ -145,24 +219,21 @@ func Filter(f filter, i interface{}) (filtered []*Item, err error) {
 
 // Sort
 
+// sortMeta returns item metadata for comparison, malformed items compare as empty
+func sortMeta(item *Item) *itemMeta {
+	m, err := item.metadata()
+	if err != nil {
+		return &itemMeta{}
+	}
+	return m
+}
+
 func (s ByPriority) Len() int      { return len(s) }
 func (s ByPriority) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 func (s ByPriority) Less(i, j int) bool {
-	vt1, _ := s[i].Vtodo()
-	vt2, _ := s[j].Vtodo()
-	prio1 := vt1.Props.Get(ical.PropPriority)
-	prio2 := vt2.Props.Get(ical.PropPriority)
-
-	var prio1Val int
-	var prio2Val int
-
-	if prio1 != nil {
-		prio1Val, _ = prio1.Int()
-	}
-	if prio2 != nil {
-		prio2Val, _ = prio2.Int()
-	}
+	prio1Val := sortMeta(s[i]).Priority
+	prio2Val := sortMeta(s[j]).Priority
 
 	if prio1Val == 0 {
 		return false
@@ -177,20 +248,8 @@ func (s ByDue) Len() int      { return len(s) }
 func (s ByDue) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 func (s ByDue) Less(i, j int) bool {
-	vt1, _ := s[i].Vtodo()
-	vt2, _ := s[j].Vtodo()
-	p1 := vt1.Props.Get(ical.PropDue)
-	p2 := vt2.Props.Get(ical.PropDue)
-
-	var v1 time.Time
-	var v2 time.Time
-
-	if p1 != nil {
-		v1, _ = p1.DateTime(time.UTC)
-	}
-	if p2 != nil {
-		v2, _ = p2.DateTime(time.UTC)
-	}
+	v1 := sortMeta(s[i]).Due
+	v2 := sortMeta(s[j]).Due
 
 	if v1.IsZero() {
 		return false
@@ -205,24 +264,12 @@ func (s ByStatus) Len() int      { return len(s) }
 func (s ByStatus) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 func (s ByStatus) Less(i, j int) bool {
-	vt1, _ := s[i].Vtodo()
-	vt2, _ := s[j].Vtodo()
-	p1 := vt1.Props.Get(ical.PropStatus)
-	p2 := vt2.Props.Get(ical.PropStatus)
-
-	var v1 string
-	var v2 string
+	v1 := sortMeta(s[i]).Status
+	v2 := sortMeta(s[j]).Status
 
-	if p1 != nil {
-		v1, _ = p1.Text()
-	}
-	if p2 != nil {
-		v2, _ = p2.Text()
-	}
-
-	if ToDoStatus(v1) == StatusCompleted || ToDoStatus(v1) == StatusCancelled {
+	if v1 == StatusCompleted || v1 == StatusCancelled {
 		return false
-	} else if ToDoStatus(v2) == StatusCompleted || ToDoStatus(v2) == StatusCancelled {
+	} else if v2 == StatusCompleted || v2 == StatusCancelled {
 		return true
 	} else {
 		return false
@@ -233,20 +280,8 @@ func (s ByCreated) Len() int      { return len(s) }
 func (s ByCreated) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
 func (s ByCreated) Less(i, j int) bool {
-	vt1, _ := s[i].Vtodo()
-	vt2, _ := s[j].Vtodo()
-	p1 := vt1.Props.Get(ical.PropCreated)
-	p2 := vt2.Props.Get(ical.PropCreated)
-
-	var v1 time.Time
-	var v2 time.Time
-
-	if p1 != nil {
-		v1, _ = p1.DateTime(time.UTC)
-	}
-	if p2 != nil {
-		v2, _ = p2.DateTime(time.UTC)
-	}
+	v1 := sortMeta(s[i]).Created
+	v2 := sortMeta(s[j]).Created
 
 	if v1.IsZero() {
 		return true
@@ -256,3 +291,35 @@ func (s ByCreated) Less(i, j int) bool {
 		return v1.After(v2)
 	}
 }
+
+func (s ByProgress) Len() int      { return len(s) }
+func (s ByProgress) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// Less sorts todos by progress, most progressed first. Open todos with
+// subtasks use progress of their subtasks.
+func (s ByProgress) Less(i, j int) bool {
+	percent := func(item *Item) int {
+		m := sortMeta(item)
+		if p := item.progress; p.Total > 0 && m.Status != StatusCompleted {
+			return p.Percent
+		}
+		return m.Percent
+	}
+	return percent(s[i]) > percent(s[j])
+}
+
+func (s ByStart) Len() int      { return len(s) }
+func (s ByStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s ByStart) Less(i, j int) bool {
+	v1 := sortMeta(s[i]).Start
+	v2 := sortMeta(s[j]).Start
+
+	if v1.IsZero() {
+		return false
+	} else if v2.IsZero() {
+		return true
+	} else {
+		return v1.Before(v2)
+	}
+}
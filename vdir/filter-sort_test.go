@@ -0,0 +1,83 @@
+package vdir
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func BenchmarkSort(b *testing.B) {
+	dir := b.TempDir()
+	generateVdir(b, dir, 1, 2000)
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		b.Fatal(err)
+	}
+	items := vd.Items()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		sort.Sort(ByDue(items))
+		sort.Sort(ByPriority(items))
+		sort.Sort(ByCreated(items))
+	}
+}
+
+func TestSortByPriority(t *testing.T) {
+	dir := t.TempDir()
+	generateVdir(t, dir, 1, 20)
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	items := vd.Items()
+	sort.Stable(ByPriority(items))
+
+	var prios []int
+	for _, item := range items {
+		m, err := item.metadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prios = append(prios, m.Priority)
+	}
+
+	// unset priorities sort last
+	for n := 1; n < len(prios); n++ {
+		prev, cur := prios[n-1], prios[n]
+		if (prev == 0 && cur != 0) || (cur != 0 && cur < prev) {
+			t.Fatalf("priorities not sorted: %v", prios)
+		}
+	}
+}
+
+func TestFilterByStart(t *testing.T) {
+	now := time.Date(2021, 7, 15, 12, 0, 0, 0, time.Local)
+	v := newTestVdir(t,
+		testTodo{Summary: "no start", Status: StatusNeedsAction},
+		testTodo{Summary: "started earlier", Status: StatusNeedsAction, Start: now.Add(-time.Hour)},
+		testTodo{Summary: "deferred", Status: StatusNeedsAction, Start: now.Add(time.Hour)},
+		testTodo{Summary: "deferred but in process", Status: StatusInProcess, Start: now.AddDate(0, 0, 2)},
+	)
+
+	filtered, err := Filter(ByStart(v.Items()), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range filtered {
+		todo, err := item.Todo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, todo.Summary())
+	}
+	want := []string{"no start", "started earlier", "deferred but in process"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Filter(ByStart) mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,75 @@
+package vdir
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// testTodo describes a todo written to a test vdir, zero fields are unset
+type testTodo struct {
+	UID          string
+	Summary      string // may contain hashtags
+	Status       ToDoStatus
+	Percent      int
+	Parent       string
+	DependsOn    []string
+	Start        time.Time
+	Due          time.Time
+	Alarms       []Alarm
+	RecurrenceID time.Time
+}
+
+// newTestVdir writes todos to files of a single collection and loads them
+// with Init, so that items get IDs in order of todos
+func newTestVdir(t *testing.T, todos ...testTodo) *Vdir {
+	t.Helper()
+	dir := t.TempDir()
+	col := filepath.Join(dir, "tasks")
+	if err := os.Mkdir(col, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for n, tt := range todos {
+		todo := NewTodo()
+		if tt.UID != "" {
+			todo.setText(ical.PropUID, tt.UID)
+		}
+		todo.SetSummary(tt.Summary)
+		if tt.Status != "" {
+			todo.SetStatus(tt.Status)
+		}
+		todo.setPercentComplete(tt.Percent)
+		todo.SetParent(tt.Parent)
+		for _, uid := range tt.DependsOn {
+			todo.AddDependency(uid)
+		}
+		todo.SetStart(tt.Start, false)
+		todo.SetDue(tt.Due, false)
+		for _, a := range tt.Alarms {
+			todo.AddAlarm(a)
+		}
+		todo.setDate(ical.PropRecurrenceID, tt.RecurrenceID, false)
+
+		var buf bytes.Buffer
+		if err := ical.NewEncoder(&buf).Encode(todo.Calendar()); err != nil {
+			t.Fatal(err)
+		}
+		// file names keep todos in walk order
+		name := filepath.Join(col, fmt.Sprintf("%03d.ics", n))
+		if err := os.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	return vd
+}
@@ -0,0 +1,163 @@
+package vdir
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IDIndexFile is a filename tdx uses to persist short todo IDs inside vdir
+const IDIndexFile = ".tdx-ids"
+
+// idReuseDelay is how long an ID of a removed todo isn't given to new todos,
+// so that an ID typed from an outdated list doesn't select another todo
+const idReuseDelay = 24 * time.Hour
+
+// idIndex maps todo keys (UIDs) to short numeric IDs that stay stable across runs.
+// IDs of removed todos are kept with the time they were freed until they can
+// be reused. In the index file they are written as negative IDs.
+type idIndex struct {
+	path    string
+	ids     map[string]int
+	freed   map[int]time.Time
+	changed bool
+}
+
+// loadIDIndex reads an ID index from path, a missing file results in an empty index
+func loadIDIndex(path string) (*idIndex, error) {
+	idx := &idIndex{
+		path:  path,
+		ids:   make(map[string]int),
+		freed: make(map[int]time.Time),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Malformed ID index line: %q (%s)", line, path)
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("Malformed ID index line: %q (%s)", line, path)
+		}
+		if id < 0 {
+			freed, err := time.Parse(time.RFC3339, fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("Malformed ID index line: %q (%s)", line, path)
+			}
+			idx.freed[-id] = freed
+			continue
+		}
+		idx.ids[fields[1]] = id
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// assign returns IDs for given keys at time now. Keys missing from the index
+// are removed and their IDs are freed. New keys get the lowest free IDs in
+// the given order, IDs freed less than idReuseDelay ago are skipped.
+func (x *idIndex) assign(keys []string, now time.Time) map[string]int {
+	present := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		present[k] = true
+	}
+	for k, id := range x.ids {
+		if !present[k] {
+			delete(x.ids, k)
+			x.freed[id] = now
+			x.changed = true
+		}
+	}
+	for id, freed := range x.freed {
+		if now.Sub(freed) >= idReuseDelay {
+			delete(x.freed, id)
+			x.changed = true
+		}
+	}
+
+	used := make(map[int]bool, len(x.ids)+len(x.freed))
+	for _, id := range x.ids {
+		used[id] = true
+	}
+	for id := range x.freed {
+		used[id] = true
+	}
+
+	next := 1
+	for _, k := range keys {
+		if _, ok := x.ids[k]; ok {
+			continue
+		}
+		for used[next] {
+			next++
+		}
+		x.ids[k] = next
+		used[next] = true
+		x.changed = true
+	}
+
+	return x.ids
+}
+
+// save writes the index to disk if it was changed
+func (x *idIndex) save() error {
+	if !x.changed {
+		return nil
+	}
+
+	keys := make([]string, 0, len(x.ids))
+	for k := range x.ids {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return x.ids[keys[i]] < x.ids[keys[j]] })
+
+	sb := strings.Builder{}
+	for _, k := range keys {
+		sb.WriteString(fmt.Sprintf("%d %s\n", x.ids[k], k))
+	}
+
+	freed := make([]int, 0, len(x.freed))
+	for id := range x.freed {
+		freed = append(freed, id)
+	}
+	sort.Ints(freed)
+	for _, id := range freed {
+		sb.WriteString(fmt.Sprintf("%d %s\n", -id, x.freed[id].UTC().Format(time.RFC3339)))
+	}
+
+	if err := writeFileAtomic(x.path, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	x.changed = false
+
+	return nil
+}
+
+// indexPath returns a path to the ID index file for vdir at path
+func indexPath(path string) string {
+	return filepath.Join(path, IDIndexFile)
+}
@@ -1,15 +1,16 @@
 package vdir
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
 	"math/rand"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -28,6 +29,7 @@ const (
 	StatusCancelled   ToDoStatus = "CANCELLED"
 	StatusInProcess   ToDoStatus = "IN-PROCESS"
 	StatusAny         ToDoStatus = "ANY"
+	StatusOpen        ToDoStatus = "OPEN" // needs-action or in-process, used for filtering
 
 	PriorityHigh   ToDoPriority = 1
 	PriorityMedium ToDoPriority = 5
@@ -47,16 +49,55 @@ const (
 	FormatFullRaw FormatFullOption = iota
 )
 
-const hashtagRe = "\\B#\\w+"
+// productID is a PRODID of calendars created by tdx
+const productID = "-//KKGA.ME//NONSGML tdx//EN"
 
-// Item is an iCalendar item with a unique id
+// Item is an iCalendar todo with a unique id. A file may contain several todos,
+// e.g. recurrence overrides, every todo is a separate item sharing file data.
 type Item struct {
 	Id   int
 	Path string
-	Ical *ical.Calendar
+	Ical *ical.Calendar // calendar containing the todo
+
+	file  *itemFile
+	index int             // position of todo among all todos in file
+	comp  *ical.Component // resolved todo component
+	gen   int             // file generation comp was resolved in
+	meta  *itemMeta
+
+	lockPath string // lock file of vdir, set by Vdir
+
+	progress Progress // completion of subtasks, set by Vdir
+	blockers []*Item  // open todos the item depends on, set by Vdir
+}
+
+// itemFile is an ical file shared by all items it contains
+type itemFile struct {
+	path   string
+	cals   []*ical.Calendar
+	state  fileState
+	loaded bool
+	gen    int // incremented on every read
+}
+
+// fileTodo is a todo component and a calendar containing it
+type fileTodo struct {
+	cal  *ical.Calendar
+	comp *ical.Component
+}
+
+// fileState is a snapshot of item file taken when it was read or written
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
 }
 
-// Tag is a hashtag label in todo summary
+// maxUpdateRetries is a number of times Update re-reads an item after a conflict
+const maxUpdateRetries = 3
+
+// Tag is a hashtag label in todo text, such as #work, including the tag prefix.
+// Tags keep case they were written in and are compared ignoring case.
 type Tag string
 
 // DecodeError is an error occured during ical decoding
@@ -69,9 +110,18 @@ func (d *DecodeError) Error() string {
 	return fmt.Sprintf("%s (%s)", d.Err, d.Path)
 }
 
-// String returns a lowercased tag string without hash prefix
+// ConflictError is an error occured when item file was changed after it was read
+type ConflictError struct {
+	Path string
+}
+
+func (c *ConflictError) Error() string {
+	return fmt.Sprintf("Todo was modified by another program since it was read (%s)", c.Path)
+}
+
+// String returns a tag string without tag prefix
 func (t Tag) String() string {
-	return strings.ToLower(strings.TrimPrefix(string(t), "#"))
+	return strings.TrimPrefix(string(t), tagPrefix)
 }
 
 // String returns a lowercased todo status string
@@ -79,41 +129,236 @@ func (s ToDoStatus) String() string {
 	return strings.ToLower(string(s))
 }
 
-// Init initializes an Item with a decoded ical data from path
-func (i *Item) Init(path string) error {
-	file, err := os.Open(path)
+// read decodes all calendars in file
+func (f *itemFile) read() error {
+	file, err := os.Open(f.path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	i.Path = path
 
-	dec := ical.NewDecoder(file)
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
 
+	var cals []*ical.Calendar
+	dec := ical.NewDecoder(bytes.NewReader(data))
 	for {
 		cal, err := dec.Decode()
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			return &DecodeError{
-				i.Path,
+				f.path,
 				err,
 			}
 		}
+		cals = append(cals, cal)
+	}
 
-		// filter only items that contain vtodo
+	f.cals = cals
+	f.state = fileState{info.ModTime(), info.Size(), sha256.Sum256(data)}
+	f.loaded = true
+	f.gen++
+	return nil
+}
+
+// todos returns all todo components in file, in order of appearance
+func (f *itemFile) todos() (todos []fileTodo) {
+	for _, cal := range f.cals {
 		for _, comp := range cal.Children {
 			if comp.Name == ical.CompToDo {
-				i.Ical = cal
+				todos = append(todos, fileTodo{cal, comp})
+			}
+		}
+	}
+	return
+}
+
+// encode returns all calendars in file encoded as ical data
+func (f *itemFile) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, cal := range f.cals {
+		if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// items returns an item for every todo in file
+func (f *itemFile) items() (items []*Item) {
+	for n, t := range f.todos() {
+		items = append(items, &Item{
+			Path:  f.path,
+			Ical:  t.cal,
+			file:  f,
+			index: n,
+			comp:  t.comp,
+			gen:   f.gen,
+		})
+	}
+	return
+}
+
+// Init initializes an Item with a decoded ical data from path,
+// the item holds the first todo found in file
+func (i *Item) Init(path string) error {
+	i.Path = path
+
+	f := &itemFile{path: path}
+	if err := f.read(); err != nil {
+		return err
+	}
+	if items := f.items(); len(items) > 0 {
+		id := i.Id
+		*i = *items[0]
+		i.Id = id
+	}
+	return nil
+}
+
+// Reload re-reads item data from file at Item.Path, keeping its ID
+func (i *Item) Reload() error {
+	if i.file == nil {
+		i.file = &itemFile{path: i.Path}
+	}
+	if err := i.file.read(); err != nil {
+		return err
+	}
+	return i.load()
+}
+
+// Update applies mutate to item and writes it. If the file was changed by
+// another program in the meantime, the item is re-read and mutate is retried.
+func (i *Item) Update(mutate func(*Item) error) error {
+	for attempt := 0; ; attempt++ {
+		if err := mutate(i); err != nil {
+			return err
+		}
+		i.meta = nil
+		err := i.WriteFile()
+		var conflict *ConflictError
+		if errors.As(err, &conflict) && attempt < maxUpdateRetries {
+			if err := i.Reload(); err != nil {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// checkUnchanged returns a ConflictError if file at Item.Path differs from
+// the state it had when the item was read
+func (i *Item) checkUnchanged() error {
+	var state fileState
+	if i.file != nil {
+		state = i.file.state
+	}
+
+	f, err := os.Stat(i.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// new items must not overwrite an existing file and vice versa
+		if state == (fileState{}) {
+			return nil
+		}
+		return &ConflictError{i.Path}
+	} else if err != nil {
+		return err
+	}
+	if state == (fileState{}) {
+		return &ConflictError{i.Path}
+	}
+	if !f.ModTime().Equal(state.modTime) || f.Size() != state.size {
+		return &ConflictError{i.Path}
+	}
+
+	// items loaded from cache are not read yet and have no hash
+	if state.hash == ([sha256.Size]byte{}) {
+		return nil
+	}
+	data, err := os.ReadFile(i.Path)
+	if err != nil {
+		return err
+	}
+	if sha256.Sum256(data) != state.hash {
+		return &ConflictError{i.Path}
+	}
+	return nil
+}
+
+// load decodes ical data from Item.Path, if it wasn't decoded yet,
+// and resolves the item todo in file
+func (i *Item) load() error {
+	if i.file == nil {
+		// new items are not backed by a file yet
+		if i.Ical != nil {
+			return nil
+		}
+		if i.Path == "" {
+			return fmt.Errorf("Can not load Item without Path: %v", i)
+		}
+		i.file = &itemFile{path: i.Path}
+	}
+	if !i.file.loaded {
+		if err := i.file.read(); err != nil {
+			return err
+		}
+	}
+
+	todos := i.file.todos()
+
+	// todo already resolved in current file data, its position may have changed
+	if i.comp != nil && i.gen == i.file.gen {
+		for n, t := range todos {
+			if t.comp == i.comp {
+				i.index = n
+				i.Ical = t.cal
 				return nil
 			}
 		}
+		return fmt.Errorf("Vtodo not found: %q", i.Path)
 	}
+
+	if i.index >= len(todos) {
+		return fmt.Errorf("Vtodo not found: %q", i.Path)
+	}
+	t := todos[i.index]
+	i.Ical, i.comp, i.gen = t.cal, t.comp, i.file.gen
+	// metadata is re-parsed from decoded data
+	i.meta = nil
 	return nil
 }
 
+// metadata returns a typed view of todo fields used for filtering and sorting.
+// The view is taken from cache or parsed once from ical data, and is rebuilt
+// after the item is changed with Update or written.
+func (i *Item) metadata() (*itemMeta, error) {
+	if i.meta != nil {
+		return i.meta, nil
+	}
+	t, err := i.Todo()
+	if err != nil {
+		return nil, err
+	}
+	i.meta = newItemMeta(t)
+	return i.meta, nil
+}
+
 // Vtodo returns a pointer to inner todo ical component
 func (i *Item) Vtodo() (*ical.Component, error) {
+	if err := i.load(); err != nil {
+		return nil, err
+	}
+	if i.comp != nil {
+		return i.comp, nil
+	}
 	for _, comp := range i.Ical.Children {
 		if comp.Name == ical.CompToDo {
 			return comp, nil
@@ -122,6 +367,43 @@ func (i *Item) Vtodo() (*ical.Component, error) {
 	return nil, fmt.Errorf("Vtodo not found: %q", i.Ical.Name)
 }
 
+// key returns a key identifying the todo in vdir: its UID, followed by
+// recurrence ID for recurrence overrides
+func (i *Item) key() string {
+	m, err := i.metadata()
+	if err != nil || m.UID == "" {
+		return ""
+	}
+	if m.RecurrenceID != "" {
+		return fmt.Sprintf("%s;%s=%s", m.UID, ical.PropRecurrenceID, m.RecurrenceID)
+	}
+	return m.UID
+}
+
+// UID returns the UID of inner todo or an empty string
+func (i *Item) UID() string {
+	m, err := i.metadata()
+	if err != nil {
+		return ""
+	}
+	return m.UID
+}
+
+// SubtaskProgress returns completion of item subtasks, Total is 0 for
+// todos without subtasks
+func (i *Item) SubtaskProgress() Progress {
+	return i.progress
+}
+
+// ParentUID returns the UID of parent todo or an empty string
+func (i *Item) ParentUID() string {
+	m, err := i.metadata()
+	if err != nil {
+		return ""
+	}
+	return m.Parent
+}
+
 // FormatFull returns a full detailed info about an item
 func (i *Item) FormatFull(options ...FormatFullOption) (string, error) {
 	sb := strings.Builder{}
@@ -136,6 +418,9 @@ func (i *Item) FormatFull(options ...FormatFullOption) (string, error) {
 	}
 
 	if checkOpt(FormatFullRaw) {
+		if err := i.load(); err != nil {
+			return "", err
+		}
 		j, err := json.MarshalIndent(i, "", " ")
 		if err != nil {
 			return "", err
@@ -149,29 +434,61 @@ func (i *Item) FormatFull(options ...FormatFullOption) (string, error) {
 		sb.WriteString(fmt.Sprintf("ID: %d\n", i.Id))
 		for name, prop := range vtodo.Props {
 			p := prop[0]
-			if date, _ := p.DateTime(time.Local); !date.IsZero() {
-				sb.WriteString(fmt.Sprintf("%s: %s\n", name, date.Format("2 Jan 2006 15:04")))
+			if name == PropCompletedHistory {
+				continue
+			} else if vt := p.ValueType(); vt != ical.ValueDate && vt != ical.ValueDateTime {
+				sb.WriteString(fmt.Sprintf("%s: %s\n", name, p.Value))
+			} else if date, allDay, _ := ParseDateTime(i.Ical, &p); allDay {
+				sb.WriteString(fmt.Sprintf("%s: %s\n", name, date.Format("2 Jan 2006")))
+			} else if !date.IsZero() {
+				sb.WriteString(fmt.Sprintf("%s: %s\n", name, date.In(DisplayLocation()).Format("2 Jan 2006 15:04")))
 			} else {
 				sb.WriteString(fmt.Sprintf("%s: %s\n", name, p.Value))
 			}
 		}
+
+		t := &Todo{vtodo, i.Ical}
+		if alarms := t.Alarms(); len(alarms) > 0 {
+			reminders := make([]string, len(alarms))
+			for n, a := range alarms {
+				reminders[n] = a.String()
+				if at, ok := a.Time(t); ok && a.IsRelative() {
+					reminders[n] += fmt.Sprintf(" (%s)", at.In(DisplayLocation()).Format("2 Jan 2006 15:04"))
+				}
+			}
+			sb.WriteString(fmt.Sprintf("REMINDERS: %s\n", strings.Join(reminders, ", ")))
+		}
+		if next, allDay, err := t.NextOccurrences(5, time.Now()); err == nil && len(next) > 0 {
+			sb.WriteString(fmt.Sprintf("NEXT OCCURRENCES: %s\n", formatDates(next, allDay)))
+		}
+		if history := t.CompletionHistory(); len(history) > 0 {
+			sb.WriteString(fmt.Sprintf("COMPLETION HISTORY: %s\n", formatDates(history, false)))
+		}
 	}
 
 	return sb.String(), nil
 }
 
+// formatDates returns a comma-separated list of dates
+func formatDates(dates []time.Time, allDay bool) string {
+	s := make([]string, len(dates))
+	for n, d := range dates {
+		if allDay {
+			s[n] = d.Format("2 Jan 2006")
+		} else {
+			s[n] = d.In(DisplayLocation()).Format("2 Jan 2006 15:04")
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
 // Format returns a readable representation of an item
 func (i *Item) Format(options ...FormatOption) (string, error) {
-
-	vtodo, err := i.Vtodo()
+	t, err := i.Todo()
 	if err != nil {
 		return "", err
 	}
 
-	if vtodo.Name != ical.CompToDo {
-		return "", fmt.Errorf("Not VTODO component: %v", vtodo)
-	}
-
 	var (
 		status      string
 		summary     string
@@ -179,107 +496,87 @@ func (i *Item) Format(options ...FormatOption) (string, error) {
 		prio        string
 		due         string
 		repeat      string
+		progress    string
+		subtasks    string
+		blocked     string
+		start       string
 	)
 
-	for name, prop := range vtodo.Props {
-		p := prop[0]
-
-		switch name {
-
-		case ical.PropStatus:
-			colDone := color.New(color.Faint).SprintFunc()
-			colUndone := color.New(color.FgBlue).SprintFunc()
-			if ToDoStatus(p.Value) == StatusCompleted {
-				status = colDone("[x]")
-			} else if ToDoStatus(p.Value) == StatusCancelled {
-				status = colDone("[-]")
-			} else {
-				status = colUndone("[ ]")
-			}
-
-		case ical.PropSummary:
-			summary = p.Value
+	colDone := color.New(color.Faint).SprintFunc()
+	colUndone := color.New(color.FgBlue).SprintFunc()
+	colStarted := color.New(color.FgYellow).SprintFunc()
+	switch t.Status() {
+	case StatusCompleted:
+		status = colDone("[x]")
+	case StatusCancelled:
+		status = colDone("[-]")
+	case StatusInProcess:
+		status = colStarted("[~]")
+		if p := t.PercentComplete(); p > 0 {
+			progress = colStarted(fmt.Sprintf("%d%%", p))
+		}
+	default:
+		status = colUndone("[ ]")
+	}
 
-			tags, err := i.Tags()
-			if err != nil {
-				return "", err
-			}
-			if len(tags) > 0 {
-				c := color.New(color.FgBlue).SprintFunc()
-				for _, t := range tags {
-					tag := c(fmt.Sprintf("#%s", t))
-					// TODO: split into lowercase strings before replacing
-					summary = strings.ReplaceAll(summary, string(t), tag)
-				}
+	summary = t.Summary()
+	if tags := t.Tags(); len(tags) > 0 {
+		c := color.New(color.FgBlue).SprintFunc()
+		summary = rewriteHashtags(summary, func(tag Tag) string {
+			return c(string(tag))
+		})
+		hashtags := t.Hashtags()
+		for _, tag := range tags {
+			// categories are shown after summary
+			if !containsTag(hashtags, tag) {
+				summary = fmt.Sprintf("%s %s", summary, c(string(tag)))
 			}
+		}
+	}
 
-		case ical.PropDescription:
-			col := color.New(color.Faint, color.Italic).SprintFunc()
-			description = col(p.Value)
+	if d := t.Description(); d != "" {
+		col := color.New(color.Faint, color.Italic).SprintFunc()
+		description = col(d)
+	}
 
-		case ical.PropRecurrenceRule:
-			c := color.New(color.FgYellow).SprintFunc()
-			repeat = c("⟳")
+	if t.RRule() != "" {
+		c := color.New(color.FgYellow).SprintFunc()
+		repeat = c("⟳")
+	}
 
-		case ical.PropDue:
-			d, _ := p.DateTime(time.Local)
-			if d.IsZero() {
-				continue
-			}
-			now := time.Now()
-			diff := d.Sub(now)
-			diff = diff.Round(1 * time.Minute)
-
-			var prefix string
-			var humanDate string
-			var col func(a ...interface{}) string
-
-			if math.Abs(diff.Hours()) < 24 {
-				if now.Day() == d.Day() {
-					col = color.New(color.FgYellow).SprintFunc()
-					prefix = ""
-					humanDate = "today"
-				} else if math.Signbit(diff.Hours()) {
-					col = color.New(color.FgRed).SprintFunc()
-					prefix = "overdue "
-					humanDate = "yesterday"
-				} else {
-					col = color.New(color.FgYellow).SprintFunc()
-					prefix = ""
-					humanDate = "tomorrow"
-				}
-			} else {
-				if math.Signbit(diff.Hours()) {
-					prefix = "overdue "
-					col = color.New(color.FgRed).SprintFunc()
-				} else {
-					prefix = "in "
-					col = color.New(color.Faint).SprintFunc()
-				}
+	if open := t.Status() == StatusNeedsAction || t.Status() == StatusInProcess; open && len(i.blockers) > 0 {
+		ids := make([]string, len(i.blockers))
+		for n, b := range i.blockers {
+			ids[n] = strconv.Itoa(b.Id)
+		}
+		c := color.New(color.FgRed).SprintFunc()
+		blocked = c(fmt.Sprintf("(blocked by %s)", strings.Join(ids, ", ")))
+	}
 
-				humanDate = durafmt.ParseShort(diff).String()
-			}
+	// deferred todos show when they start
+	if d, allDay := t.Start(); d.After(time.Now()) && t.Status() == StatusNeedsAction {
+		start = formatStart(d, allDay)
+	}
 
-			humanDate = strings.TrimPrefix(humanDate, "-")
-			due = col(fmt.Sprintf("(%s%s)", prefix, humanDate))
+	if p := i.progress; p.Total > 0 {
+		c := color.New(color.FgCyan).SprintFunc()
+		subtasks = c(fmt.Sprintf("[%d/%d]", p.Done, p.Total))
+	}
 
-		case ical.PropPriority:
-			colHigh := color.New(color.FgHiRed, color.Bold).SprintFunc()
-			colMedium := color.New(color.FgHiYellow, color.Bold).SprintFunc()
-			v, err := strconv.Atoi(p.Value)
-			if err != nil {
-				return "", err
-			}
-			switch {
-			case ToDoPriority(v) == PriorityHigh:
-				prio = colHigh("!!!")
-			case ToDoPriority(v) > PriorityHigh && ToDoPriority(v) <= PriorityMedium:
-				prio = colMedium("!!")
-			case ToDoPriority(v) > PriorityMedium:
-				prio = colMedium("!")
-			}
+	// completed todos show when they were done instead of due date
+	if d := t.Completed(); t.Status() == StatusCompleted && !d.IsZero() {
+		due = formatCompleted(d)
+	} else if d, allDay := t.Due(); !d.IsZero() {
+		due = formatDue(d, allDay)
+	}
 
-		}
+	colHigh := color.New(color.FgHiRed, color.Bold).SprintFunc()
+	colMedium := color.New(color.FgHiYellow, color.Bold).SprintFunc()
+	switch p := t.Priority(); {
+	case p.IsHigh():
+		prio = colHigh(p)
+	case p.IsMedium(), p.IsLow():
+		prio = colMedium(p)
 	}
 
 	checkOpt := func(o FormatOption) bool {
@@ -311,13 +608,19 @@ func (i *Item) Format(options ...FormatOption) (string, error) {
 
 	todoSb.WriteString(fmt.Sprintf(" %s", summary))
 
-	if due != "" {
-		metaSb.WriteString(due)
+	for _, m := range []string{subtasks, progress, start, due, blocked} {
+		if m == "" {
+			continue
+		}
+		if metaSb.Len() > 0 {
+			metaSb.WriteString(" ")
+		}
+		metaSb.WriteString(m)
 	}
 
 	if checkOpt(FormatDescription) && description != "" {
 		colFaint := color.New(color.Faint).SprintFunc()
-		if due != "" {
+		if metaSb.Len() > 0 {
 			metaSb.WriteString(fmt.Sprintf(" %s %s", colFaint("|"), description))
 		} else {
 			metaSb.WriteString(description)
@@ -339,11 +642,105 @@ func (i *Item) Format(options ...FormatOption) (string, error) {
 	return todoSb.String(), nil
 }
 
-// WriteFile encodes ical data and writes to file at Item.Path
+// formatDue returns a colored human readable due date relative to now
+func formatDue(d time.Time, allDay bool) string {
+	now := time.Now()
+	diff := d.Sub(now).Round(1 * time.Minute)
+	if allDay {
+		// all-day dates are compared by calendar days
+		y, m, day := now.Date()
+		now = time.Date(y, m, day, 0, 0, 0, 0, time.Local)
+		diff = d.Sub(now).Round(24 * time.Hour)
+	}
+
+	var prefix string
+	var humanDate string
+	var col func(a ...interface{}) string
+
+	if math.Abs(diff.Hours()) < 24 || allDay && math.Abs(diff.Hours()) == 24 {
+		if now.Day() == d.Day() {
+			col = color.New(color.FgYellow).SprintFunc()
+			prefix = ""
+			humanDate = "today"
+		} else if math.Signbit(diff.Hours()) {
+			col = color.New(color.FgRed).SprintFunc()
+			prefix = "overdue "
+			humanDate = "yesterday"
+		} else {
+			col = color.New(color.FgYellow).SprintFunc()
+			prefix = ""
+			humanDate = "tomorrow"
+		}
+	} else {
+		if math.Signbit(diff.Hours()) {
+			prefix = "overdue "
+			col = color.New(color.FgRed).SprintFunc()
+		} else {
+			prefix = "in "
+			col = color.New(color.Faint).SprintFunc()
+		}
+
+		humanDate = durafmt.ParseShort(diff).String()
+	}
+
+	humanDate = strings.TrimPrefix(humanDate, "-")
+	return col(fmt.Sprintf("(%s%s)", prefix, humanDate))
+}
+
+// formatStart returns a human readable start date of a deferred todo
+func formatStart(d time.Time, allDay bool) string {
+	col := color.New(color.Faint).SprintFunc()
+
+	now := time.Now()
+	y, m, day := now.Date()
+	today := time.Date(y, m, day, 0, 0, 0, 0, time.Local)
+
+	var humanDate string
+	switch {
+	case d.Before(today.AddDate(0, 0, 1)):
+		humanDate = "today"
+	case d.Before(today.AddDate(0, 0, 2)):
+		humanDate = "tomorrow"
+	case allDay:
+		humanDate = "in " + durafmt.ParseShort(d.Sub(today).Round(24*time.Hour)).String()
+	default:
+		humanDate = "in " + durafmt.ParseShort(d.Sub(now).Round(time.Hour)).String()
+	}
+
+	return col(fmt.Sprintf("(starts %s)", humanDate))
+}
+
+// formatCompleted returns a human readable completion date relative to now
+func formatCompleted(d time.Time) string {
+	col := color.New(color.Faint).SprintFunc()
+
+	loc := DisplayLocation()
+	now := time.Now().In(loc)
+	y, m, day := now.Date()
+	today := time.Date(y, m, day, 0, 0, 0, 0, loc)
+
+	var humanDate string
+	switch d = d.In(loc); {
+	case !d.Before(today):
+		humanDate = "today"
+	case !d.Before(today.AddDate(0, 0, -1)):
+		humanDate = "yesterday"
+	default:
+		humanDate = durafmt.ParseShort(now.Sub(d).Round(24*time.Hour)).String() + " ago"
+	}
+
+	return col(fmt.Sprintf("(done %s)", humanDate))
+}
+
+// WriteFile encodes ical data and atomically writes to file at Item.Path.
+// A ConflictError is returned if the file was changed since it was read.
 func (i *Item) WriteFile() error {
 	if i.Path == "" {
 		return fmt.Errorf("Can not write Item without Path: %v", i)
 	}
+	if err := i.load(); err != nil {
+		return err
+	}
 
 	// check and set topmost calendar object props
 	requiredIcalProps := []string{
@@ -355,7 +752,7 @@ func (i *Item) WriteFile() error {
 		if prop == nil || prop.Value == "" {
 			switch p {
 			case ical.PropProductID:
-				i.Ical.Props.SetText(ical.PropProductID, "-//KKGA.ME//NONSGML tdx//EN")
+				i.Ical.Props.SetText(ical.PropProductID, productID)
 			case ical.PropVersion:
 				i.Ical.Props.SetText(ical.PropVersion, "2.0")
 			}
@@ -424,86 +821,163 @@ func (i *Item) WriteFile() error {
 		st.Value = string(StatusNeedsAction)
 	}
 
-	var buf bytes.Buffer
-	err = ical.NewEncoder(&buf).Encode(i.Ical)
-	if err != nil {
-		return err
+	// new items become backed by a file once written
+	if i.file == nil {
+		i.file = &itemFile{path: i.Path, cals: []*ical.Calendar{i.Ical}, loaded: true}
+		i.comp = vtodo
+		i.gen = i.file.gen
 	}
 
-	f, err := os.Create(i.Path)
+	data, err := i.file.encode()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	w := bufio.NewWriter(f)
-	_, err = w.Write(buf.Bytes())
+	l, err := i.lock()
 	if err != nil {
 		return err
 	}
+	defer l.unlock() // nolint: errcheck
 
-	err = w.Flush()
-	if err != nil {
+	if err := i.checkUnchanged(); err != nil {
 		return err
 	}
+	if err := i.file.write(data); err != nil {
+		return err
+	}
+	i.meta = nil
 
 	return nil
 }
 
-// Tags returns a slice of hashtag strings parsed from summary and description
-func (i *Item) Tags() (tags []Tag, err error) {
-	re := regexp.MustCompile(hashtagRe)
+// write atomically writes data to file and records its new state
+func (f *itemFile) write(data []byte) error {
+	// keep permissions of existing file
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(f.path); err == nil {
+		perm = info.Mode().Perm()
+	}
 
-	vt, err := i.Vtodo()
-	if err != nil {
-		return
+	if err := writeFileAtomic(f.path, data, perm); err != nil {
+		return err
 	}
-	s, err := vt.Props.Text(ical.PropSummary)
+
+	info, err := os.Stat(f.path)
 	if err != nil {
-		return
+		return err
+	}
+	f.state = fileState{info.ModTime(), info.Size(), sha256.Sum256(data)}
+	return nil
+}
+
+// Delete removes the item todo from vdir. Deleting a recurring todo also removes
+// its overrides. The file is removed once it doesn't contain any todos.
+// A ConflictError is returned if the file was changed since it was read.
+func (i *Item) Delete() error {
+	if i.Path == "" {
+		return fmt.Errorf("Can not delete Item without Path: %v", i)
 	}
-	d, err := vt.Props.Text(ical.PropDescription)
+
+	vtodo, err := i.Vtodo()
 	if err != nil {
-		return
+		return err
 	}
+	uid, _ := vtodo.Props.Text(ical.PropUID)
+	isMaster := vtodo.Props.Get(ical.PropRecurrenceID) == nil
 
-	st := re.FindAllString(s, -1)
-	dt := re.FindAllString(d, -1)
+	isDeleted := func(comp *ical.Component) bool {
+		if comp == vtodo {
+			return true
+		}
+		if !isMaster || comp.Name != ical.CompToDo || uid == "" {
+			return false
+		}
+		u, _ := comp.Props.Text(ical.PropUID)
+		return u == uid
+	}
 
-	tagExists := func(tags []Tag, t Tag) bool {
-		for _, tag := range tags {
-			if tag == t {
-				return true
+	// keep calendars that have components other than deleted todos and timezones
+	var (
+		kept      []*ical.Calendar
+		children  = make(map[*ical.Calendar][]*ical.Component)
+		remaining int
+	)
+	for _, cal := range i.file.cals {
+		keep := false
+		for _, comp := range cal.Children {
+			if isDeleted(comp) {
+				continue
+			}
+			children[cal] = append(children[cal], comp)
+			if comp.Name != ical.CompTimezone {
+				keep = true
+			}
+			if comp.Name == ical.CompToDo {
+				remaining++
 			}
 		}
-		return false
+		if keep {
+			kept = append(kept, cal)
+		}
 	}
 
-	for _, t := range st {
-		if !tagExists(tags, Tag(t)) {
-			tags = append(tags, Tag(strings.ToLower(t)))
-		}
+	l, err := i.lock()
+	if err != nil {
+		return err
 	}
-	for _, t := range dt {
-		if !tagExists(tags, Tag(t)) {
-			tags = append(tags, Tag(strings.ToLower(t)))
-		}
+	defer l.unlock() // nolint: errcheck
+
+	if err := i.checkUnchanged(); err != nil {
+		return err
 	}
-	return
+
+	if remaining == 0 {
+		return removeFile(i.Path)
+	}
+
+	f := &itemFile{path: i.Path}
+	for _, cal := range kept {
+		c := *cal.Component
+		c.Children = children[cal]
+		f.cals = append(f.cals, &ical.Calendar{Component: &c})
+	}
+	data, err := f.encode()
+	if err != nil {
+		return err
+	}
+	if err := i.file.write(data); err != nil {
+		return err
+	}
+
+	// other items of the file keep pointers to their components
+	for _, cal := range kept {
+		cal.Children = children[cal]
+	}
+	i.file.cals = kept
+	return nil
+}
+
+// Tags returns a slice of hashtag strings parsed from summary and description
+func (i *Item) Tags() (tags []Tag, err error) {
+	m, err := i.metadata()
+	if err != nil {
+		return
+	}
+	return m.Tags, nil
 }
 
-// HasTag reports whether an item has a given tag
+// HasTag reports whether an item has a given tag or one of its nested tags
 func (i *Item) HasTag(t Tag) (bool, error) {
 	tags, err := i.Tags()
 	if err != nil {
 		return false, err
 	}
-	if !strings.HasPrefix(string(t), "#") {
-		t = Tag(fmt.Sprintf("#%s", string(t)))
+	if !strings.HasPrefix(string(t), tagPrefix) {
+		t = Tag(tagPrefix + string(t))
 	}
 
 	for _, tag := range tags {
-		if tag == t {
+		if t.Includes(tag) {
 			return true, nil
 		}
 	}
@@ -1,37 +1,41 @@
 package vdir
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/emersion/go-ical"
 	"github.com/google/go-cmp/cmp"
 )
 
 func TestTags(t *testing.T) {
 	cwd, _ := os.Getwd()
-	vdpath := path.Join(cwd, "testdata/vdir/with_tags/")
+	vdpath := t.TempDir()
+	copyDir(t, path.Join(cwd, "testdata/vdir/with_tags/"), vdpath)
 	var tests = []struct {
 		path string
 		want []Tag
 	}{
-		{vdpath, []Tag{"#quebec", "#1some", "#tags", "#go", "#sway", "#later"}},
+		{vdpath, []Tag{"#Quebec", "#1some", "#tags", "#FAMILY", "#FINANCE", "#go", "#sway", "#Later"}},
 	}
 	for _, tt := range tests {
 		t.Run("", func(t *testing.T) {
-			vd := Vdir{}
+			vd := &Vdir{}
 			if err := vd.Init(tt.path); err != nil {
 				t.Fatal(err)
 			}
 			got := []Tag{}
-			for _, items := range vd {
-				for _, item := range items {
-					tags, err := item.Tags()
-					if err != nil {
-						t.Fatal(err)
-					}
-					got = append(got, tags...)
+			for _, item := range vd.Items() {
+				tags, err := item.Tags()
+				if err != nil {
+					t.Fatal(err)
 				}
+				got = append(got, tags...)
 			}
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Errorf("Tags() mismatch (-want +got):\n%s", diff)
@@ -39,3 +43,197 @@ func TestTags(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFile(t *testing.T) {
+	cwd, _ := os.Getwd()
+	src := path.Join(cwd, "testdata/vdir/tasks/")
+	dir := t.TempDir()
+	copyDir(t, src, dir)
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range vd.Items() {
+		if err := item.WriteFile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// temporary files must be renamed into place
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("temporary file left in vdir: %s", e.Name())
+		}
+	}
+
+	written := &Vdir{}
+	if err := written.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(written.Items()), len(vd.Items()); got != want {
+		t.Errorf("items after write: want %d, got %d", want, got)
+	}
+}
+
+func TestWriteFileConflict(t *testing.T) {
+	cwd, _ := os.Getwd()
+	src := path.Join(cwd, "testdata/vdir/tasks/")
+	dir := t.TempDir()
+	copyDir(t, src, dir)
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	item, err := vd.ItemById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a change made by another program
+	data, err := os.ReadFile(item.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(string(data), "SUMMARY:", "SUMMARY:Changed ", 1)
+	if err := os.WriteFile(item.Path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var conflict *ConflictError
+	if err := item.WriteFile(); !errors.As(err, &conflict) {
+		t.Fatalf("WriteFile: want ConflictError, got %v", err)
+	}
+
+	err = item.Update(func(i *Item) error {
+		vt, err := i.Vtodo()
+		if err != nil {
+			return err
+		}
+		vt.Props.SetText(ical.PropStatus, string(StatusCompleted))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vt, _ := item.Vtodo()
+	summary, _ := vt.Props.Text(ical.PropSummary)
+	if !strings.HasPrefix(summary, "Changed ") {
+		t.Errorf("Update did not re-read changed file, summary: %q", summary)
+	}
+}
+
+func TestWriteFileLocksVdir(t *testing.T) {
+	cwd, _ := os.Getwd()
+	dir := t.TempDir()
+	copyDir(t, path.Join(cwd, "testdata/multi"), dir)
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	item := vd.Items()[0]
+
+	// writes of items wait for the lock Init takes on vdir
+	l, err := lockFile(path.Join(dir, LockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- item.WriteFile() }()
+	select {
+	case <-done:
+		t.Fatal("WriteFile() did not wait for vdir lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := l.unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(path.Dir(item.Path), LockFile)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("lock file created in collection: %v", err)
+	}
+
+	standalone := &Item{Path: item.Path, Ical: item.Ical}
+	if err := standalone.WriteFile(); err == nil {
+		t.Error("WriteFile() of item without vdir: want error")
+	}
+}
+
+func TestMultipleTodos(t *testing.T) {
+	cwd, _ := os.Getwd()
+	src := path.Join(cwd, "testdata/multi/tasks/")
+	dir := t.TempDir()
+	copyDir(t, src, dir)
+
+	summaries := func(vd *Vdir) (ss []string) {
+		for _, item := range vd.Items() {
+			vt, err := item.Vtodo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, _ := vt.Props.Text(ical.PropSummary)
+			ss = append(ss, s)
+		}
+		return
+	}
+
+	vd := &Vdir{}
+	if err := vd.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Water plants", "Water plants on Tuesday", "Bundled todo"}
+	if diff := cmp.Diff(want, summaries(vd)); diff != "" {
+		t.Fatalf("todos mismatch (-want +got):\n%s", diff)
+	}
+
+	// writing a single todo keeps the rest of the file
+	item, err := vd.ItemByUID("bundled@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := item.WriteFile(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(item.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"RECURRENCE-ID", "Water plants on Tuesday", "X-UNKNOWN-PROP:keep me"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("written file lost %q", s)
+		}
+	}
+
+	// deleting a recurring todo removes its overrides
+	master, err := vd.ItemByUID("recurring@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := master.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	vd = &Vdir{}
+	if err := vd.Init(dir, InitCache); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Bundled todo"}, summaries(vd)); diff != "" {
+		t.Errorf("todos after delete mismatch (-want +got):\n%s", diff)
+	}
+
+	// deleting the last todo removes the file
+	if err := vd.Items()[0].Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(item.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file with no todos left was not removed: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package vdir
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// LockFile is a filename tdx uses to serialize writes of concurrent tdx processes
+const LockFile = ".tdx-lock"
+
+// lock is an exclusive advisory lock held on a lock file
+type lock struct {
+	f *os.File
+}
+
+// lockFile acquires an exclusive lock on file at path, creating it if needed
+func lockFile(path string) (*lock, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &lock{f}, nil
+}
+
+// lock acquires the lock of vdir the item belongs to, blocking until it's available
+func (i *Item) lock() (*lock, error) {
+	if i.lockPath == "" {
+		return nil, fmt.Errorf("Item is not part of a vdir: %q", i.Path)
+	}
+	return lockFile(i.lockPath)
+}
+
+// unlock releases the lock
+func (l *lock) unlock() error {
+	defer l.f.Close()
+	return syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+}
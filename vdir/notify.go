@@ -0,0 +1,116 @@
+package vdir
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// NotifyFile is a filename tdx uses to store the time of last notification inside vdir
+	NotifyFile = ".tdx-notified"
+	// NotifyLockFile is a filename tdx uses to serialize notifications
+	NotifyLockFile = ".tdx-notify-lock"
+)
+
+// Reminder is a moment an open todo needs attention: when it falls due
+// or when one of its alarms triggers
+type Reminder struct {
+	Collection *Collection
+	Item       *Item
+	Time       time.Time
+	Alarm      *Alarm // nil when todo falls due
+}
+
+// Reminders returns reminders of open todos that fire after from and not
+// later than to, ordered by time. All-day todos fall due at local midnight.
+func (v *Vdir) Reminders(from, to time.Time) (reminders []Reminder, err error) {
+	err = v.Walk(func(c *Collection, item *Item) error {
+		m, err := item.metadata()
+		if err != nil {
+			return err
+		}
+		if m.Status != StatusNeedsAction && m.Status != StatusInProcess {
+			return nil
+		}
+		if m.Due.After(from) && !m.Due.After(to) {
+			reminders = append(reminders, Reminder{c, item, m.Due, nil})
+		}
+		for n := range m.Alarms {
+			a := m.Alarms[n]
+			if t, ok := a.time(m.Start, m.Due); ok && t.After(from) && !t.After(to) {
+				reminders = append(reminders, Reminder{c, item, t, &a})
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].Time.Before(reminders[j].Time)
+	})
+	return
+}
+
+// Notify calls fire for every reminder since the last notification up to now
+// and records the time of last notification. Nothing fires on the first run,
+// which only records the time. Concurrent notifications are serialized, so that
+// no reminder fires twice. Notification stops at the first error of fire and
+// is recorded up to the failed reminder, so that it fires again on the next run
+// together with reminders at the same time.
+func (v *Vdir) Notify(now time.Time, fire func(Reminder) error) error {
+	// a separate lock, so that commands run by fire can write todos
+	// in a collection at vdir root
+	l, err := lockFile(filepath.Join(v.Path, NotifyLockFile))
+	if err != nil {
+		return err
+	}
+	defer l.unlock() // nolint: errcheck
+
+	path := filepath.Join(v.Path, NotifyFile)
+	last, err := readNotified(path)
+	if err != nil {
+		return err
+	}
+
+	notified := now
+	var fireErr error
+	if !last.IsZero() && last.Before(now) {
+		reminders, err := v.Reminders(last, now)
+		if err != nil {
+			return err
+		}
+		for _, r := range reminders {
+			if fireErr = fire(r); fireErr != nil {
+				// reminders fire after the recorded time
+				notified = r.Time.Add(-time.Nanosecond)
+				break
+			}
+		}
+	}
+
+	data := []byte(notified.UTC().Format(time.RFC3339Nano) + "\n")
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+	return fireErr
+}
+
+// readNotified returns time of last notification stored in path,
+// zero time if there was none
+func readNotified(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Malformed notification time: %q (%s)", strings.TrimSpace(string(data)), path)
+	}
+	return t, nil
+}
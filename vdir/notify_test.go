@@ -0,0 +1,86 @@
+package vdir
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNotify(t *testing.T) {
+	now := time.Date(2021, 7, 14, 12, 0, 0, 0, time.UTC)
+	v := newTestVdir(t,
+		testTodo{Status: StatusNeedsAction, Due: now.Add(time.Hour), Alarms: []Alarm{{Offset: -2 * time.Hour, FromDue: true}}},
+		testTodo{Status: StatusInProcess, Due: now.Add(-30 * time.Minute)},
+		testTodo{Status: StatusCompleted, Due: now.Add(-30 * time.Minute)},
+		testTodo{Status: StatusNeedsAction, Alarms: []Alarm{{At: now.Add(-10 * time.Minute)}, {Offset: time.Hour}}},
+	)
+
+	var fired []int
+	fire := func(r Reminder) error {
+		fired = append(fired, r.Item.Id)
+		return nil
+	}
+
+	if err := v.Notify(now.Add(-2*time.Hour), fire); err != nil {
+		t.Fatal(err)
+	}
+	if len(fired) != 0 {
+		t.Errorf("first Notify() fired %v, want nothing", fired)
+	}
+
+	if err := v.Notify(now, fire); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1, 2, 4}, fired); diff != "" {
+		t.Errorf("Notify() mismatch (-want +got):\n%s", diff)
+	}
+
+	fired = nil
+	if err := v.Notify(now.Add(30*time.Minute), fire); err != nil {
+		t.Fatal(err)
+	}
+	if len(fired) != 0 {
+		t.Errorf("Notify() fired %v again", fired)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	now := time.Date(2021, 7, 14, 12, 0, 0, 0, time.UTC)
+	v := newTestVdir(t,
+		testTodo{Status: StatusNeedsAction, Due: now.Add(-time.Hour)},
+		testTodo{Status: StatusNeedsAction, Due: now.Add(-30 * time.Minute)},
+		testTodo{Status: StatusNeedsAction, Due: now.Add(-30 * time.Minute)},
+		testTodo{Status: StatusNeedsAction, Due: now.Add(-10 * time.Minute)},
+	)
+
+	var fired []int
+	failing := 3
+	fire := func(r Reminder) error {
+		fired = append(fired, r.Item.Id)
+		if r.Item.Id == failing {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	if err := v.Notify(now.Add(-2*time.Hour), fire); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Notify(now, fire); err == nil {
+		t.Fatal("Notify() error = nil, want error of fire")
+	}
+	if diff := cmp.Diff([]int{1, 2, 3}, fired); diff != "" {
+		t.Errorf("Notify() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the failed reminder fires again together with the following ones
+	fired, failing = nil, 0
+	if err := v.Notify(now.Add(time.Minute), fire); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{2, 3, 4}, fired); diff != "" {
+		t.Errorf("Notify() after failure mismatch (-want +got):\n%s", diff)
+	}
+}
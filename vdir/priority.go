@@ -0,0 +1,127 @@
+package vdir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PriorityNone is an undefined priority, other values are RFC 5545 priorities
+// from 1 (highest) to 9 (lowest)
+const PriorityNone ToDoPriority = 0
+
+// PriorityRange is an inclusive range of priorities used for filtering
+type PriorityRange struct {
+	Min ToDoPriority
+	Max ToDoPriority
+}
+
+// IsValid reports whether p is within RFC 5545 range
+func (p ToDoPriority) IsValid() bool {
+	return p >= PriorityNone && p <= 9
+}
+
+// IsHigh reports whether p is one of high priorities (1-4)
+func (p ToDoPriority) IsHigh() bool { return p >= 1 && p <= 4 }
+
+// IsMedium reports whether p is a medium priority (5)
+func (p ToDoPriority) IsMedium() bool { return p == 5 }
+
+// IsLow reports whether p is one of low priorities (6-9)
+func (p ToDoPriority) IsLow() bool { return p >= 6 && p <= 9 }
+
+// String returns a short priority notation: exclamation marks for default
+// priorities of each class and pN for others
+func (p ToDoPriority) String() string {
+	switch p {
+	case PriorityNone:
+		return ""
+	case PriorityHigh:
+		return "!!!"
+	case PriorityMedium:
+		return "!!"
+	case PriorityLow:
+		return "!"
+	default:
+		return fmt.Sprintf("p%d", int(p))
+	}
+}
+
+// ParsePriority parses a priority given as !!!/!!/!, high/medium/low,
+// p0-p9 or a plain number 0-9. An empty string is no priority.
+func ParsePriority(s string) (ToDoPriority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "", "none":
+		return PriorityNone, nil
+	case "!!!", "high":
+		return PriorityHigh, nil
+	case "!!", "medium":
+		return PriorityMedium, nil
+	case "!", "low":
+		return PriorityLow, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "p"))
+	if err != nil || !ToDoPriority(n).IsValid() {
+		return PriorityNone, fmt.Errorf("Invalid priority: %q", s)
+	}
+	return ToDoPriority(n), nil
+}
+
+// ParsePriorityRange parses a priority filter. Priority classes (high, medium,
+// low and their !-notations) match all priorities of the class, an exact
+// priority can be compared with =, <, <=, > and >=, e.g. '<=4'. Comparisons
+// never match undefined priority, which is selected with 'none'.
+func ParsePriorityRange(s string) (PriorityRange, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "none":
+		return PriorityRange{PriorityNone, PriorityNone}, nil
+	case "!!!", "high":
+		return PriorityRange{1, 4}, nil
+	case "!!", "medium":
+		return PriorityRange{5, 5}, nil
+	case "!", "low":
+		return PriorityRange{6, 9}, nil
+	}
+
+	var op string
+	for _, o := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(s, o) {
+			op = o
+			break
+		}
+	}
+
+	p, err := ParsePriority(strings.TrimPrefix(s, op))
+	if err != nil || strings.TrimPrefix(s, op) == "" {
+		return PriorityRange{}, fmt.Errorf("Invalid priority filter: %q", s)
+	}
+
+	r := PriorityRange{p, p}
+	switch op {
+	case "<":
+		r = PriorityRange{1, p - 1}
+	case "<=":
+		r = PriorityRange{1, p}
+	case ">":
+		r = PriorityRange{p + 1, 9}
+	case ">=":
+		r = PriorityRange{p, 9}
+	}
+	if op != "" && op != "=" && r.Min < 1 {
+		r.Min = 1
+	}
+	if r.Min > r.Max {
+		return PriorityRange{}, fmt.Errorf("Priority filter matches nothing: %q", s)
+	}
+	return r, nil
+}
+
+// Contains reports whether priority p is within range
+func (r PriorityRange) Contains(p ToDoPriority) bool {
+	return p >= r.Min && p <= r.Max
+}
@@ -0,0 +1,61 @@
+package vdir
+
+import "testing"
+
+func TestParsePriority(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want ToDoPriority
+		err  bool
+	}{
+		{"", PriorityNone, false},
+		{"!!!", PriorityHigh, false},
+		{"!!", PriorityMedium, false},
+		{"!", PriorityLow, false},
+		{"High", PriorityHigh, false},
+		{"low", PriorityLow, false},
+		{"p3", 3, false},
+		{"P9", 9, false},
+		{"7", 7, false},
+		{"p10", PriorityNone, true},
+		{"urgent", PriorityNone, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePriority(tt.in)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("ParsePriority(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePriorityRange(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want PriorityRange
+		err  bool
+	}{
+		{"none", PriorityRange{0, 0}, false},
+		{"high", PriorityRange{1, 4}, false},
+		{"!!", PriorityRange{5, 5}, false},
+		{"low", PriorityRange{6, 9}, false},
+		{"p3", PriorityRange{3, 3}, false},
+		{">=5", PriorityRange{5, 9}, false},
+		{">p5", PriorityRange{6, 9}, false},
+		{"<=4", PriorityRange{1, 4}, false},
+		{"<3", PriorityRange{1, 2}, false},
+		{">0", PriorityRange{1, 9}, false},
+		{"<1", PriorityRange{}, true},
+		{">=", PriorityRange{}, true},
+		{"~5", PriorityRange{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePriorityRange(tt.in)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("ParsePriorityRange(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package vdir
+
+import (
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const (
+	// PropCompletedHistory is a prop tdx uses to record recent completions of a recurring todo
+	PropCompletedHistory = "X-TDX-COMPLETED"
+	// PropRepeatFrom is a prop tdx uses to make todo repeat after completion instead of due date
+	PropRepeatFrom = "X-TDX-REPEAT-FROM"
+
+	repeatFromCompletion = "COMPLETION"
+
+	// maxCompletionHistory is a number of completions kept in history
+	maxCompletionHistory = 10
+)
+
+// frameTime returns date prop value as a time used for recurrence arithmetic.
+// Values with TZID are returned as wall clock times in UTC, so that occurrences
+// keep their wall clock time across DST changes, other values are local.
+func frameTime(prop *ical.Prop) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(prop.Value)
+
+	switch {
+	case prop.ValueType() == ical.ValueDate || len(value) == len(icalDate):
+		t, err = time.ParseInLocation(icalDate, value, time.Local)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse(icalDateTimeUTC, value)
+		return t.In(time.Local), false, err
+	case prop.Params.Get(ical.ParamTimezoneID) != "":
+		t, err = time.Parse(icalDateTime, value)
+		return t, false, err
+	default:
+		t, err = time.ParseInLocation(icalDateTime, value, time.Local)
+		return t, false, err
+	}
+}
+
+// setFrameTime sets date prop value to a time returned by frameTime,
+// keeping prop value type and timezone
+func setFrameTime(prop *ical.Prop, t time.Time) {
+	value := strings.TrimSpace(prop.Value)
+
+	switch {
+	case prop.ValueType() == ical.ValueDate || len(value) == len(icalDate):
+		prop.Value = t.Format(icalDate)
+	case strings.HasSuffix(value, "Z"):
+		prop.Value = t.UTC().Format(icalDateTimeUTC)
+	default:
+		prop.Value = t.Format(icalDateTime)
+	}
+}
+
+// shiftTime moves t by the same number of calendar days and clock difference
+// as there is between from and to
+func shiftTime(t, from, to time.Time) time.Time {
+	y1, m1, d1 := from.Date()
+	y2, m2, d2 := to.Date()
+	days := int(time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC).Sub(time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+
+	clock := func(t time.Time) int {
+		h, m, s := t.Clock()
+		return h*3600 + m*60 + s
+	}
+
+	y, m, d := t.Date()
+	h, min, s := t.Clock()
+	return time.Date(y, m, d+days, h, min, s+clock(to)-clock(from), 0, t.Location())
+}
+
+// recurrenceAnchor returns the date prop recurrence is computed from,
+// DTSTART if it's set or DUE otherwise
+func (t *Todo) recurrenceAnchor() *ical.Prop {
+	if p := t.Props.Get(ical.PropDateTimeStart); p != nil && p.Value != "" {
+		return p
+	}
+	if p := t.Props.Get(ical.PropDue); p != nil && p.Value != "" {
+		return p
+	}
+	return nil
+}
+
+// exdates returns excluded occurrences in the same form as frameTime
+func (t *Todo) exdates() (dates []time.Time) {
+	for _, p := range t.Props[ical.PropExceptionDates] {
+		for _, v := range strings.Split(p.Value, ",") {
+			prop := ical.Prop{Name: p.Name, Params: p.Params, Value: v}
+			if d, _, err := frameTime(&prop); err == nil {
+				dates = append(dates, d)
+			}
+		}
+	}
+	return
+}
+
+// RepeatsFromCompletion reports whether todo repeats after completion
+// instead of its due date
+func (t *Todo) RepeatsFromCompletion() bool {
+	return strings.EqualFold(t.text(PropRepeatFrom), repeatFromCompletion)
+}
+
+// SetRepeatFromCompletion sets whether todo repeats after completion
+func (t *Todo) SetRepeatFromCompletion(fromCompletion bool) {
+	if fromCompletion {
+		t.setText(PropRepeatFrom, repeatFromCompletion)
+	} else {
+		t.Props.Del(PropRepeatFrom)
+	}
+}
+
+// RepeatError returns an error if todo has a recurrence rule that tdx can't
+// repeat, e.g. with BYSETPOS or an hourly frequency
+func (t *Todo) RepeatError() error {
+	if t.RRule() == "" {
+		return nil
+	}
+	_, err := ParseRRule(t.RRule())
+	return err
+}
+
+// CompletionHistory returns recent times when a recurring todo was completed
+func (t *Todo) CompletionHistory() (history []time.Time) {
+	for _, p := range t.Props[PropCompletedHistory] {
+		p := p
+		if d, _, err := ParseDateTime(t.cal, &p); err == nil {
+			history = append(history, d)
+		}
+	}
+	return
+}
+
+// Complete completes todo at given time. A recurring todo is moved to its
+// next occurrence and reopened instead, the completion is recorded in history.
+// Todos with rules that can't be parsed are completed, see RepeatError.
+// Complete reports whether todo was moved to the next occurrence.
+func (t *Todo) Complete(at time.Time) (bool, error) {
+	anchor := t.recurrenceAnchor()
+	if t.RRule() == "" || anchor == nil || t.Props.Get(ical.PropRecurrenceID) != nil {
+		t.MarkCompleted(at)
+		return false, nil
+	}
+
+	r, err := ParseRRule(t.RRule())
+	if err != nil {
+		t.MarkCompleted(at)
+		return false, nil
+	}
+	start, allDay, err := frameTime(anchor)
+	if err != nil {
+		return false, err
+	}
+	exdates := t.exdates()
+
+	var (
+		next  time.Time
+		found bool
+		used  int // occurrences consumed from COUNT
+	)
+	if t.RepeatsFromCompletion() {
+		// next occurrence is counted from completion day, keeping time of day
+		done := at.In(time.Local)
+		h, min, s := start.Clock()
+		if allDay {
+			h, min, s = 0, 0, 0
+		}
+		base := time.Date(done.Year(), done.Month(), done.Day(), h, min, s, 0, start.Location())
+		count := r.Count
+		r.Count = 0
+		next, found = r.Next(base, base, exdates)
+		r.Count, used = count, 1
+	} else {
+		n := 0
+		r.Iterate(start, func(o time.Time) bool {
+			if o.After(start) && !containsTime(exdates, o) {
+				next, found, used = o, true, n
+				return false
+			}
+			n++
+			return true
+		})
+	}
+
+	history := ical.NewProp(PropCompletedHistory)
+	history.SetDateTime(at.UTC())
+	t.Props.Add(history)
+	if n := len(t.Props[PropCompletedHistory]); n > maxCompletionHistory {
+		t.Props[PropCompletedHistory] = t.Props[PropCompletedHistory][n-maxCompletionHistory:]
+	}
+
+	if !found || r.Count > 0 && r.Count-used < 1 {
+		t.MarkCompleted(at)
+		return false, nil
+	}
+
+	for _, name := range []string{ical.PropDateTimeStart, ical.PropDue} {
+		p := t.Props.Get(name)
+		if p == nil || p.Value == "" {
+			continue
+		}
+		d, _, err := frameTime(p)
+		if err != nil {
+			return false, err
+		}
+		setFrameTime(p, shiftTime(d, start, next))
+	}
+
+	if r.Count > 0 {
+		r.Count -= used
+		t.SetRRule(r.String())
+	}
+
+	t.Reopen()
+	return true, nil
+}
+
+// NextOccurrences returns up to n occurrences of a recurring todo after given time
+func (t *Todo) NextOccurrences(n int, after time.Time) (occurrences []time.Time, allDay bool, err error) {
+	anchor := t.recurrenceAnchor()
+	if t.RRule() == "" || anchor == nil {
+		return nil, false, nil
+	}
+	r, err := ParseRRule(t.RRule())
+	if err != nil {
+		return nil, false, err
+	}
+	start, allDay, err := frameTime(anchor)
+	if err != nil {
+		return nil, false, err
+	}
+	exdates := t.exdates()
+
+	r.Iterate(start, func(o time.Time) bool {
+		if containsTime(exdates, o) {
+			return true
+		}
+		// convert occurrence back to an actual time, e.g. resolving its TZID
+		p := ical.Prop{Name: anchor.Name, Params: anchor.Params, Value: anchor.Value}
+		setFrameTime(&p, o)
+		d, _, err := ParseDateTime(t.cal, &p)
+		if err != nil {
+			return false
+		}
+		if d.After(after) {
+			occurrences = append(occurrences, d)
+		}
+		return len(occurrences) < n
+	})
+	return occurrences, allDay, nil
+}
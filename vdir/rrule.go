@@ -0,0 +1,411 @@
+package vdir
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Frequency is a FREQ of recurrence rule
+type Frequency string
+
+const (
+	FreqDaily   Frequency = "DAILY"
+	FreqWeekly  Frequency = "WEEKLY"
+	FreqMonthly Frequency = "MONTHLY"
+	FreqYearly  Frequency = "YEARLY"
+)
+
+// maxEmptyPeriods limits how many periods without occurrences are checked
+// before iteration stops, e.g. for rules like BYMONTHDAY=31;BYMONTH=2
+const maxEmptyPeriods = 3000
+
+// WeekdayNum is a BYDAY value, a weekday with an optional ordinal, e.g. -1SU
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// RRule is a parsed recurrence rule. Supported parts are FREQ (daily and
+// longer), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH.
+type RRule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+
+	until string // raw UNTIL value, kept to preserve its format
+	extra []string
+}
+
+// ParseRRule parses RRULE value
+func ParseRRule(s string) (*RRule, error) {
+	r := &RRule{Interval: 1}
+
+	for _, part := range strings.Split(strings.TrimSpace(s), ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid recurrence rule: %q", s)
+		}
+		name, value := strings.ToUpper(kv[0]), kv[1]
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			switch r.Freq {
+			case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+			default:
+				return nil, fmt.Errorf("Unsupported recurrence frequency: %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = fmt.Errorf("Invalid interval")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = fmt.Errorf("Invalid count")
+			}
+		case "UNTIL":
+			r.until = value
+			p := ical.NewProp("UNTIL")
+			p.Value = value
+			var allDay bool
+			r.Until, allDay, err = ParseDateTime(nil, p)
+			if allDay {
+				// until date is inclusive
+				r.Until = r.Until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, day, ok := parseByDay(strings.ToUpper(d))
+				if !ok {
+					return nil, fmt.Errorf("Invalid recurrence rule: %q", s)
+				}
+				r.ByDay = append(r.ByDay, WeekdayNum{n, day})
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("Invalid recurrence rule: %q", s)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, m := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(m)
+				if err != nil || n < 1 || n > 12 {
+					return nil, fmt.Errorf("Invalid recurrence rule: %q", s)
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			// weeks always start on monday
+			r.extra = append(r.extra, part)
+		default:
+			return nil, fmt.Errorf("Unsupported recurrence rule part: %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid recurrence rule: %q", s)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("Recurrence rule without frequency: %q", s)
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("Recurrence rule with both COUNT and UNTIL: %q", s)
+	}
+	return r, nil
+}
+
+// String returns RRULE value of the rule
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		until := r.until
+		if until == "" {
+			until = r.Until.UTC().Format(icalDateTimeUTC)
+		}
+		parts = append(parts, "UNTIL="+until)
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	parts = append(parts, r.extra...)
+	return strings.Join(parts, ";")
+}
+
+// String returns BYDAY notation of weekday, e.g. 2MO
+func (w WeekdayNum) String() string {
+	day := strings.ToUpper(w.Day.String()[:2])
+	if w.N != 0 {
+		return fmt.Sprintf("%d%s", w.N, day)
+	}
+	return day
+}
+
+// Iterate calls fn for every occurrence of rule starting at dtstart, in order,
+// until fn returns false. Dtstart is always the first occurrence, COUNT and
+// UNTIL limits are applied.
+func (r *RRule) Iterate(dtstart time.Time, fn func(time.Time) bool) {
+	n := 0
+	emit := func(t time.Time) bool {
+		if r.Count > 0 && n >= r.Count {
+			return false
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		n++
+		return fn(t)
+	}
+
+	if !emit(dtstart) {
+		return
+	}
+
+	empty := 0
+	for period := 0; empty < maxEmptyPeriods; period++ {
+		candidates := r.expand(dtstart, period)
+		if len(candidates) == 0 {
+			empty++
+			continue
+		}
+		empty = 0
+		for _, c := range candidates {
+			if !c.After(dtstart) {
+				continue
+			}
+			if !emit(c) {
+				return
+			}
+		}
+	}
+}
+
+// Next returns the first occurrence after t, skipping excluded dates
+func (r *RRule) Next(dtstart, t time.Time, exdates []time.Time) (next time.Time, ok bool) {
+	r.Iterate(dtstart, func(o time.Time) bool {
+		if o.After(t) && !containsTime(exdates, o) {
+			next, ok = o, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// expand returns sorted occurrence candidates within n-th period after dtstart
+func (r *RRule) expand(dtstart time.Time, n int) (candidates []time.Time) {
+	y, m, d := dtstart.Date()
+	h, min, sec := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, h, min, sec, 0, loc)
+	}
+
+	switch r.Freq {
+	case FreqDaily:
+		candidates = []time.Time{at(y, m, d+n*r.Interval)}
+
+	case FreqWeekly:
+		if len(r.ByDay) == 0 {
+			candidates = []time.Time{at(y, m, d+7*n*r.Interval)}
+			break
+		}
+		// weeks start on monday
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := d - offset + 7*n*r.Interval
+		for _, wd := range r.ByDay {
+			candidates = append(candidates, at(y, m, monday+(int(wd.Day)+6)%7))
+		}
+
+	case FreqMonthly:
+		first := time.Date(y, m+time.Month(n*r.Interval), 1, 0, 0, 0, 0, loc)
+		candidates = r.expandMonth(first.Year(), first.Month(), d, at)
+
+	case FreqYearly:
+		year := y + n*r.Interval
+		months := r.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{m}
+		}
+		if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0 {
+			// weekdays within a whole year, e.g. 20MO is 20th monday of year
+			candidates = expandYearWeekdays(year, r.ByDay, at)
+			break
+		}
+		for _, month := range months {
+			candidates = append(candidates, r.expandMonth(year, month, d, at)...)
+		}
+	}
+
+	candidates = r.limit(candidates)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	return
+}
+
+// expandMonth returns candidates within a month, day is used when there
+// are no BYMONTHDAY and BYDAY parts
+func (r *RRule) expandMonth(year int, month time.Month, day int, at func(int, time.Month, int) time.Time) (candidates []time.Time) {
+	last := daysIn(year, month)
+
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, md := range r.ByMonthDay {
+			if md < 0 {
+				md = last + md + 1
+			}
+			if md >= 1 && md <= last {
+				candidates = append(candidates, at(year, month, md))
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, wd := range r.ByDay {
+			if wd.N != 0 {
+				if d := nthWeekday(year, month, wd.N, wd.Day); d.Month() == month {
+					candidates = append(candidates, at(year, month, d.Day()))
+				}
+				continue
+			}
+			for md := 1; md <= last; md++ {
+				if time.Date(year, month, md, 0, 0, 0, 0, time.UTC).Weekday() == wd.Day {
+					candidates = append(candidates, at(year, month, md))
+				}
+			}
+		}
+	default:
+		// months without the day are skipped, e.g. 31st in april
+		if day <= last {
+			candidates = append(candidates, at(year, month, day))
+		}
+	}
+	return
+}
+
+// expandYearWeekdays returns weekdays of a year for yearly BYDAY rules
+func expandYearWeekdays(year int, days []WeekdayNum, at func(int, time.Month, int) time.Time) (candidates []time.Time) {
+	jan1 := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	dec31 := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	for _, wd := range days {
+		first := jan1.AddDate(0, 0, (int(wd.Day)-int(jan1.Weekday())+7)%7)
+		lastDay := dec31.AddDate(0, 0, -((int(dec31.Weekday()) - int(wd.Day) + 7) % 7))
+		switch {
+		case wd.N > 0:
+			if d := first.AddDate(0, 0, 7*(wd.N-1)); d.Year() == year {
+				candidates = append(candidates, at(year, time.January, d.YearDay()))
+			}
+		case wd.N < 0:
+			if d := lastDay.AddDate(0, 0, 7*(wd.N+1)); d.Year() == year {
+				candidates = append(candidates, at(year, time.January, d.YearDay()))
+			}
+		default:
+			for d := first; d.Year() == year; d = d.AddDate(0, 0, 7) {
+				candidates = append(candidates, at(year, time.January, d.YearDay()))
+			}
+		}
+	}
+	return
+}
+
+// limit removes candidates not matching BYMONTH, and for daily rules
+// also BYMONTHDAY and BYDAY parts
+func (r *RRule) limit(candidates []time.Time) (limited []time.Time) {
+	for _, c := range candidates {
+		if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, c.Month()) {
+			continue
+		}
+		if r.Freq == FreqDaily {
+			if len(r.ByMonthDay) > 0 && !matchesMonthDay(r.ByMonthDay, c) {
+				continue
+			}
+			if len(r.ByDay) > 0 && !matchesWeekday(r.ByDay, c) {
+				continue
+			}
+		}
+		if r.Freq == FreqMonthly && len(r.ByMonthDay) > 0 && len(r.ByDay) > 0 && !matchesWeekday(r.ByDay, c) {
+			continue
+		}
+		limited = append(limited, c)
+	}
+	return
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesMonthDay(days []int, t time.Time) bool {
+	last := daysIn(t.Year(), t.Month())
+	for _, d := range days {
+		if d == t.Day() || d < 0 && last+d+1 == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesWeekday(days []WeekdayNum, t time.Time) bool {
+	for _, d := range days {
+		if d.Day == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, tt := range times {
+		if tt.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package vdir
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRRuleIterate(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+	}
+
+	var tests = []struct {
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{"FREQ=DAILY;INTERVAL=2", day(2021, 1, 30), []time.Time{day(2021, 1, 30), day(2021, 2, 1), day(2021, 2, 3)}},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", day(2021, 7, 14), []time.Time{day(2021, 7, 14), day(2021, 7, 16), day(2021, 7, 19)}},
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=2", day(2021, 7, 14), []time.Time{day(2021, 7, 14), day(2021, 7, 28)}},
+		{"FREQ=MONTHLY", day(2021, 1, 31), []time.Time{day(2021, 1, 31), day(2021, 3, 31), day(2021, 5, 31)}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", day(2021, 1, 31), []time.Time{day(2021, 1, 31), day(2021, 2, 28), day(2021, 3, 31)}},
+		{"FREQ=MONTHLY;BYDAY=-1FR", day(2021, 7, 1), []time.Time{day(2021, 7, 1), day(2021, 7, 30), day(2021, 8, 27)}},
+		{"FREQ=YEARLY;BYMONTH=3;BYDAY=2SU", day(2021, 1, 1), []time.Time{day(2021, 1, 1), day(2021, 3, 14), day(2022, 3, 13)}},
+		{"FREQ=DAILY;UNTIL=20210716", day(2021, 7, 14), []time.Time{day(2021, 7, 14), day(2021, 7, 15), day(2021, 7, 16)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []time.Time{}
+			r.Iterate(tt.start, func(o time.Time) bool {
+				got = append(got, o)
+				return len(got) < 3
+			})
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Iterate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseRRuleString(t *testing.T) {
+	for _, s := range []string{
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,-1FR",
+		"FREQ=MONTHLY;COUNT=3;BYMONTHDAY=1,-1",
+		"FREQ=YEARLY;UNTIL=20250101T000000Z;BYMONTH=6",
+	} {
+		r, err := ParseRRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.String() != s {
+			t.Errorf("String() = %q, want %q", r.String(), s)
+		}
+	}
+	if _, err := ParseRRule("FREQ=HOURLY"); err == nil {
+		t.Error("ParseRRule(FREQ=HOURLY) succeeded, want error")
+	}
+}
+
+func TestCompleteRecurring(t *testing.T) {
+	const data = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:test
+BEGIN:VTODO
+UID:1
+DTSTAMP:20210701T000000Z
+DTSTART;TZID=Europe/Berlin:20210712T090000
+DUE;TZID=Europe/Berlin:20210712T100000
+RRULE:FREQ=WEEKLY;COUNT=3
+EXDATE;TZID=Europe/Berlin:20210719T090000
+END:VTODO
+END:VCALENDAR
+`
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := &Todo{cal.Children[0], cal}
+	at := time.Date(2021, 7, 12, 12, 0, 0, 0, time.UTC)
+
+	advanced, err := todo.Complete(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !advanced || todo.Status() != StatusNeedsAction {
+		t.Fatalf("Complete() = %t, status %q, want todo moved to next occurrence", advanced, todo.Status())
+	}
+	// 19 Jul is excluded, the next occurrence is the last one
+	if v := todo.Props.Get(ical.PropDateTimeStart).Value; v != "20210726T090000" {
+		t.Errorf("DTSTART = %q, want %q", v, "20210726T090000")
+	}
+	if v := todo.Props.Get(ical.PropDue).Value; v != "20210726T100000" {
+		t.Errorf("DUE = %q, want %q", v, "20210726T100000")
+	}
+	if todo.RRule() != "FREQ=WEEKLY;COUNT=1" {
+		t.Errorf("RRule() = %q, want %q", todo.RRule(), "FREQ=WEEKLY;COUNT=1")
+	}
+
+	advanced, err = todo.Complete(at.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advanced || todo.Status() != StatusCompleted {
+		t.Errorf("Complete() = %t, status %q, want completed todo", advanced, todo.Status())
+	}
+	if len(todo.CompletionHistory()) != 2 {
+		t.Errorf("CompletionHistory() has %d entries, want 2", len(todo.CompletionHistory()))
+	}
+}
+
+func TestCompleteRepeatFromCompletion(t *testing.T) {
+	todo := NewTodo()
+	todo.SetDue(time.Date(2021, 7, 1, 0, 0, 0, 0, time.Local), true)
+	todo.SetRRule("FREQ=DAILY;INTERVAL=3")
+	todo.SetRepeatFromCompletion(true)
+
+	if _, err := todo.Complete(time.Date(2021, 7, 10, 15, 0, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2021, 7, 13, 0, 0, 0, 0, time.Local)
+	if due, allDay := todo.Due(); !due.Equal(want) || !allDay {
+		t.Errorf("Due() = %v, %t, want %v, true", due, allDay, want)
+	}
+}
+
+func TestCompleteUnsupportedRule(t *testing.T) {
+	todo := NewTodo()
+	todo.SetDue(time.Date(2021, 7, 30, 0, 0, 0, 0, time.Local), true)
+	// last weekday of the month
+	todo.SetRRule("FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1")
+
+	advanced, err := todo.Complete(time.Date(2021, 7, 30, 15, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advanced || todo.Status() != StatusCompleted {
+		t.Errorf("Complete() = %t, status %q, want completed todo", advanced, todo.Status())
+	}
+	if todo.RepeatError() == nil {
+		t.Error("RepeatError() = nil, want error for BYSETPOS")
+	}
+}
+
+func TestCompletionHistoryLimit(t *testing.T) {
+	todo := NewTodo()
+	todo.SetDue(time.Date(2021, 7, 1, 0, 0, 0, 0, time.Local), true)
+	todo.SetRRule("FREQ=DAILY")
+
+	at := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	for n := 0; n < maxCompletionHistory+5; n++ {
+		if _, err := todo.Complete(at.AddDate(0, 0, n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := todo.CompletionHistory()
+	if len(history) != maxCompletionHistory {
+		t.Fatalf("CompletionHistory() has %d entries, want %d", len(history), maxCompletionHistory)
+	}
+	if want := at.AddDate(0, 0, maxCompletionHistory+4); !history[len(history)-1].Equal(want) {
+		t.Errorf("last completion = %v, want %v", history[len(history)-1], want)
+	}
+}
@@ -0,0 +1,248 @@
+package vdir
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultTagPrefix is a character tags start with
+	DefaultTagPrefix = "#"
+	// DefaultTagPattern matches tag names made of Unicode letters, digits,
+	// hyphens and underscores, nested tags are separated by slashes,
+	// e.g. work/billing
+	DefaultTagPattern = `[\p{L}\p{M}\p{N}_-]+(?:/[\p{L}\p{M}\p{N}_-]+)*`
+)
+
+var (
+	tagPrefix     = DefaultTagPrefix
+	tagPattern    = DefaultTagPattern
+	hashtagRegexp = regexp.MustCompile(regexp.QuoteMeta(tagPrefix) + "(?:" + tagPattern + ")")
+)
+
+// TagNode is a tag in a hierarchy of nested tags
+type TagNode struct {
+	Tag      Tag
+	Items    []*Item // todos having exactly the tag
+	Count    int     // number of todos having the tag or one of its nested tags
+	Children []*TagNode
+}
+
+// SetTagSyntax sets a prefix character and a regular expression matching
+// tag names, which are used to find tags in todo text
+func SetTagSyntax(prefix, pattern string) error {
+	r, size := utf8.DecodeRuneInString(prefix)
+	if size == 0 || size != len(prefix) || r == utf8.RuneError || isTagRune(r) || unicode.IsSpace(r) {
+		return fmt.Errorf("Invalid tag prefix: %q", prefix)
+	}
+	re, err := regexp.Compile(regexp.QuoteMeta(prefix) + "(?:" + pattern + ")")
+	if err != nil || re.MatchString(prefix) {
+		return fmt.Errorf("Invalid tag pattern: %q", pattern)
+	}
+	tagPrefix, tagPattern, hashtagRegexp = prefix, pattern, re
+	return nil
+}
+
+// tagSyntax returns a string identifying current tag syntax
+func tagSyntax() string {
+	return tagPrefix + tagPattern
+}
+
+// isTagRune reports whether r is a word character that can't precede a tag
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || r == '_'
+}
+
+// findTags returns positions of tags in s. Tags start at the beginning of s
+// or after a character that isn't a letter, digit or underscore.
+func findTags(s string) (matches [][]int) {
+	for _, m := range hashtagRegexp.FindAllStringIndex(s, -1) {
+		if r, _ := utf8.DecodeLastRuneInString(s[:m[0]]); m[0] > 0 && isTagRune(r) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return
+}
+
+// parseTags returns a slice of unique tags found in texts,
+// in case of their first occurrence
+func parseTags(texts ...string) (tags []Tag) {
+	for _, text := range texts {
+		for _, m := range findTags(text) {
+			if tag := Tag(text[m[0]:m[1]]); !containsTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return
+}
+
+// ParseTag returns a tag of s, with or without tag prefix
+func ParseTag(s string) (Tag, error) {
+	tag := Tag(tagPrefix + strings.TrimPrefix(s, tagPrefix))
+	if m := findTags(string(tag)); len(m) != 1 || m[0][0] != 0 || m[0][1] != len(tag) {
+		return "", fmt.Errorf("Invalid tag: %q", s)
+	}
+	return tag, nil
+}
+
+// rewriteHashtags replaces every tag in s with text returned by fn for the
+// tag. Tags replaced with an empty text are removed together with
+// surrounding blanks, words around them stay separated by a space.
+func rewriteHashtags(s string, fn func(tag Tag) string) string {
+	sb := strings.Builder{}
+	last := 0
+	for _, m := range findTags(s) {
+		if repl := fn(Tag(s[m[0]:m[1]])); repl != "" {
+			sb.WriteString(s[last:m[0]])
+			sb.WriteString(repl)
+			last = m[1]
+			continue
+		}
+
+		start, end := m[0], m[1]
+		for start > last && (s[start-1] == ' ' || s[start-1] == '\t') {
+			start--
+		}
+		for end < len(s) && (s[end] == ' ' || s[end] == '\t') {
+			end++
+		}
+		sb.WriteString(s[last:start])
+		atStart := start == 0 || s[start-1] == '\n'
+		atEnd := end == len(s) || s[end] == '\n' || s[end] == '\r'
+		if !atStart && !atEnd {
+			sb.WriteString(" ")
+		}
+		last = end
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
+// key returns a lowercased tag, which identifies tags written in any case
+func (t Tag) key() string {
+	return strings.ToLower(string(t))
+}
+
+// Equal reports whether tags are the same, ignoring case
+func (t Tag) Equal(o Tag) bool {
+	return t.key() == o.key()
+}
+
+// Includes reports whether tag o is t or one of its nested tags, ignoring
+// case, e.g. #work includes #Work/billing
+func (t Tag) Includes(o Tag) bool {
+	k, ok := t.key(), o.key()
+	return ok == k || strings.HasPrefix(ok, k+"/")
+}
+
+// Name returns the last part of a nested tag, e.g. billing for #work/billing
+func (t Tag) Name() string {
+	s := t.String()
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+// rebase returns nested tag t of tag from moved under tag to,
+// e.g. #work/billing moved from #work to #job is #job/billing
+func (t Tag) rebase(from, to Tag) Tag {
+	parts := strings.Split(string(t), "/")
+	n := strings.Count(string(from), "/") + 1
+	return Tag(strings.Join(append([]string{string(to)}, parts[n:]...), "/"))
+}
+
+// containsTag reports whether tags contain tag t, ignoring case
+func containsTag(tags []Tag, t Tag) bool {
+	for _, tag := range tags {
+		if tag.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesTag reports whether tags contain tag t or one of its nested tags
+func includesTag(tags []Tag, t Tag) bool {
+	for _, tag := range tags {
+		if t.Includes(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// TagTree returns tags of items as a tree of nested tags ordered by tag,
+// parents of nested tags are included even if no item has them.
+// Tags are shown in case of their first occurrence.
+func TagTree(items []*Item) ([]*TagNode, error) {
+	var (
+		roots []*TagNode
+		nodes = make(map[string]*TagNode)
+		seen  = make(map[*TagNode]map[*Item]bool)
+	)
+
+	// node returns a node of tag, creating it and its parents if needed
+	var node func(tag Tag) *TagNode
+	node = func(tag Tag) *TagNode {
+		if n, ok := nodes[tag.key()]; ok {
+			return n
+		}
+		n := &TagNode{Tag: tag}
+		nodes[tag.key()] = n
+		seen[n] = make(map[*Item]bool)
+		if i := strings.LastIndex(string(tag), "/"); i > 0 {
+			p := node(tag[:i])
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+		return n
+	}
+
+	for _, item := range items {
+		tags, err := item.Tags()
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			n := node(tag)
+			n.Items = append(n.Items, item)
+
+			// count item once for a tag and its parents
+			for p := tag; ; {
+				pn := nodes[p.key()]
+				if !seen[pn][item] {
+					seen[pn][item] = true
+					pn.Count++
+				}
+				i := strings.LastIndex(string(p), "/")
+				if i <= 0 {
+					break
+				}
+				p = p[:i]
+			}
+		}
+	}
+
+	sortTagNodes(roots)
+	return roots, nil
+}
+
+// sortTagNodes orders nodes and their children by tag
+func sortTagNodes(nodes []*TagNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Tag.key() < nodes[j].Tag.key()
+	})
+	for _, n := range nodes {
+		sortTagNodes(n.Children)
+	}
+}
+
+// TagTree returns all tags in vdir as a tree of nested tags
+func (v *Vdir) TagTree() ([]*TagNode, error) {
+	return TagTree(v.Items())
+}
@@ -0,0 +1,112 @@
+package vdir
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTagTree(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{Summary: "#work/clienta/billing"},
+		testTodo{Summary: "#work/clienta #work/clienta/billing"},
+		testTodo{Summary: "#work/clientb #home"},
+		testTodo{Summary: "no tags"},
+	)
+	items := v.Items()
+
+	tree, err := TagTree(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type node struct {
+		Tag   Tag
+		Items []int
+		Count int
+		Depth int
+	}
+	var got []node
+	var walk func(nodes []*TagNode, depth int)
+	walk = func(nodes []*TagNode, depth int) {
+		for _, n := range nodes {
+			ids := []int{}
+			for _, i := range n.Items {
+				ids = append(ids, i.Id)
+			}
+			got = append(got, node{n.Tag, ids, n.Count, depth})
+			walk(n.Children, depth+1)
+		}
+	}
+	walk(tree, 0)
+
+	want := []node{
+		{"#home", []int{3}, 1, 0},
+		{"#work", []int{}, 3, 0},
+		{"#work/clienta", []int{2}, 2, 1},
+		{"#work/clienta/billing", []int{1, 2}, 2, 2},
+		{"#work/clientb", []int{3}, 1, 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TagTree() mismatch (-want +got):\n%s", diff)
+	}
+
+	for tag, want := range map[Tag]bool{"work": true, "#Work/ClientA": true, "work/client": false, "billing": false} {
+		if got, _ := items[0].HasTag(tag); got != want {
+			t.Errorf("HasTag(%q) = %t, want %t", tag, got, want)
+		}
+	}
+}
+
+func TestNestedHashtags(t *testing.T) {
+	todo := NewTodo()
+	todo.SetSummary("send #Work/ClientA/billing invoice #work #workshop")
+
+	if diff := cmp.Diff([]Tag{"#Work/ClientA/billing", "#work", "#workshop"}, todo.Tags()); diff != "" {
+		t.Errorf("Tags() mismatch (-want +got):\n%s", diff)
+	}
+
+	todo.RenameTag("#work/clienta", "#clients/a")
+	if got := todo.Summary(); got != "send #clients/a/billing invoice #work #workshop" {
+		t.Errorf("Summary() = %q", got)
+	}
+
+	todo.SetSummary("send #work/clienta invoice #work #workshop")
+	todo.RemoveTag("#work")
+	if got := todo.Summary(); got != "send invoice #workshop" {
+		t.Errorf("Summary() = %q", got)
+	}
+}
+
+func TestParseTagsUnicode(t *testing.T) {
+	strs := func(tags []Tag) (s []string) {
+		for _, tag := range tags {
+			s = append(s, string(tag))
+		}
+		return
+	}
+
+	got := parseTags("read #Éducation and #задачи/дом, #well-known_tag", "a#b #éducation #1st", "ti#mer #")
+	want := []string{"#Éducation", "#задачи/дом", "#well-known_tag", "#1st"}
+	if diff := cmp.Diff(want, strs(got)); diff != "" {
+		t.Errorf("parseTags() mismatch (-want +got):\n%s", diff)
+	}
+
+	defer SetTagSyntax(DefaultTagPrefix, DefaultTagPattern) // nolint: errcheck
+	if err := SetTagSyntax("@", `[a-z]+`); err != nil {
+		t.Fatal(err)
+	}
+	got = parseTags("ping @anna and @Bob at me@example.org #work")
+	if diff := cmp.Diff([]string{"@anna"}, strs(got)); diff != "" {
+		t.Errorf("parseTags() mismatch (-want +got):\n%s", diff)
+	}
+	if tag, err := ParseTag("@anna"); err != nil || tag != "@anna" {
+		t.Errorf("ParseTag() = %q, %v", tag, err)
+	}
+
+	for _, syntax := range [][2]string{{"", `\w+`}, {"ab", `\w+`}, {"x", `\w+`}, {"#", `\w*`}, {"#", `[`}} {
+		if err := SetTagSyntax(syntax[0], syntax[1]); err == nil {
+			t.Errorf("SetTagSyntax(%q, %q) succeeded, want error", syntax[0], syntax[1])
+		}
+	}
+}
@@ -0,0 +1,658 @@
+package vdir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Todo is a typed view of a VTODO component. Getters and setters work directly
+// on component props, so props unknown to tdx are kept intact.
+type Todo struct {
+	*ical.Component
+	cal *ical.Calendar // calendar containing the todo, used to resolve timezones
+}
+
+// RelationType is a RELTYPE of RELATED-TO prop
+type RelationType string
+
+const (
+	RelationParent  RelationType = "PARENT"
+	RelationChild   RelationType = "CHILD"
+	RelationSibling RelationType = "SIBLING"
+	// RelationDependsOn is an RFC 9253 dependency on another todo
+	RelationDependsOn RelationType = "DEPENDS-ON"
+)
+
+// Relation is a link to another todo by its UID
+type Relation struct {
+	Type RelationType
+	UID  string
+}
+
+// NewTodo returns a todo with a generated UID inside a new calendar
+func NewTodo() *Todo {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, productID)
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	comp := ical.NewComponent(ical.CompToDo)
+	comp.Props.SetText(ical.PropUID, GenerateUID())
+	comp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	comp.Props.SetText(ical.PropStatus, string(StatusNeedsAction))
+	cal.Children = append(cal.Children, comp)
+	return &Todo{comp, cal}
+}
+
+// Todo returns a typed view of item todo
+func (i *Item) Todo() (*Todo, error) {
+	vtodo, err := i.Vtodo()
+	if err != nil {
+		return nil, err
+	}
+	return &Todo{vtodo, i.Ical}, nil
+}
+
+// Calendar returns the calendar containing the todo
+func (t *Todo) Calendar() *ical.Calendar {
+	return t.cal
+}
+
+// text returns an unescaped text value of prop, or raw value if it's malformed
+func (t *Todo) text(name string) string {
+	p := t.Props.Get(name)
+	if p == nil {
+		return ""
+	}
+	if s, err := p.Text(); err == nil {
+		return s
+	}
+	return p.Value
+}
+
+// setText sets a text prop, an empty text removes the prop
+func (t *Todo) setText(name, text string) {
+	if text == "" {
+		t.Props.Del(name)
+		return
+	}
+	t.Props.SetText(name, text)
+}
+
+// date returns a parsed date prop, malformed dates are treated as unset
+func (t *Todo) date(name string) (time.Time, bool) {
+	d, allDay, err := ParseDateTime(t.cal, t.Props.Get(name))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return d, allDay
+}
+
+// setDate sets a date prop, a zero time removes the prop
+func (t *Todo) setDate(name string, d time.Time, allDay bool) {
+	if d.IsZero() {
+		t.Props.Del(name)
+		return
+	}
+	t.Props.Set(NewDateTimeProp(name, d, allDay))
+}
+
+// UID returns todo UID
+func (t *Todo) UID() string {
+	return t.text(ical.PropUID)
+}
+
+// Summary returns todo summary
+func (t *Todo) Summary() string {
+	return t.text(ical.PropSummary)
+}
+
+// SetSummary sets todo summary
+func (t *Todo) SetSummary(s string) {
+	t.setText(ical.PropSummary, s)
+}
+
+// Description returns todo description
+func (t *Todo) Description() string {
+	return t.text(ical.PropDescription)
+}
+
+// SetDescription sets todo description
+func (t *Todo) SetDescription(s string) {
+	t.setText(ical.PropDescription, s)
+}
+
+// Status returns todo status, a missing status means NEEDS-ACTION
+func (t *Todo) Status() ToDoStatus {
+	s := ToDoStatus(strings.ToUpper(strings.TrimSpace(t.text(ical.PropStatus))))
+	if s == "" {
+		return StatusNeedsAction
+	}
+	return s
+}
+
+// SetStatus sets todo status
+func (t *Todo) SetStatus(s ToDoStatus) {
+	t.setText(ical.PropStatus, string(s))
+}
+
+// Priority returns todo priority, 0 if it's undefined, malformed or out of range
+func (t *Todo) Priority() ToDoPriority {
+	p := t.Props.Get(ical.PropPriority)
+	if p == nil {
+		return 0
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(p.Value))
+	if err != nil || !ToDoPriority(v).IsValid() {
+		return 0
+	}
+	return ToDoPriority(v)
+}
+
+// SetPriority sets todo priority, 0 removes the priority
+func (t *Todo) SetPriority(p ToDoPriority) {
+	if p == 0 {
+		t.Props.Del(ical.PropPriority)
+		return
+	}
+	prop := ical.NewProp(ical.PropPriority)
+	prop.Value = fmt.Sprint(int(p))
+	t.Props.Set(prop)
+}
+
+// Due returns todo due date and reports whether it's an all-day date
+func (t *Todo) Due() (time.Time, bool) {
+	return t.date(ical.PropDue)
+}
+
+// SetDue sets todo due date, a zero time removes the due date
+func (t *Todo) SetDue(d time.Time, allDay bool) {
+	t.setDate(ical.PropDue, d, allDay)
+}
+
+// Start returns todo start date and reports whether it's an all-day date
+func (t *Todo) Start() (time.Time, bool) {
+	return t.date(ical.PropDateTimeStart)
+}
+
+// SetStart sets todo start date, a zero time removes the start date
+func (t *Todo) SetStart(d time.Time, allDay bool) {
+	t.setDate(ical.PropDateTimeStart, d, allDay)
+}
+
+// Created returns todo creation time
+func (t *Todo) Created() time.Time {
+	d, _ := t.date(ical.PropCreated)
+	return d
+}
+
+// Completed returns todo completion time
+func (t *Todo) Completed() time.Time {
+	d, _ := t.date(ical.PropCompleted)
+	return d
+}
+
+// SetCompleted sets todo completion time, a zero time removes it
+func (t *Todo) SetCompleted(d time.Time) {
+	t.setDate(ical.PropCompleted, d, false)
+}
+
+// PercentComplete returns todo progress in percent, 100 for completed
+// todos without PERCENT-COMPLETE
+func (t *Todo) PercentComplete() int {
+	if p := t.Props.Get(ical.PropPercentComplete); p != nil {
+		if v, err := p.Int(); err == nil && v >= 0 && v <= 100 {
+			return v
+		}
+	}
+	if t.Status() == StatusCompleted {
+		return 100
+	}
+	return 0
+}
+
+// setPercentComplete sets todo progress, 0 removes the prop
+func (t *Todo) setPercentComplete(n int) {
+	if n <= 0 {
+		t.Props.Del(ical.PropPercentComplete)
+		return
+	}
+	prop := ical.NewProp(ical.PropPercentComplete)
+	prop.Value = strconv.Itoa(n)
+	t.Props.Set(prop)
+}
+
+// MarkCompleted completes todo at given time, setting STATUS, COMPLETED
+// and PERCENT-COMPLETE
+func (t *Todo) MarkCompleted(at time.Time) {
+	t.SetStatus(StatusCompleted)
+	t.SetCompleted(at)
+	t.setPercentComplete(100)
+}
+
+// MarkInProcess marks todo as started, progress of a previously completed
+// todo is reset
+func (t *Todo) MarkInProcess() {
+	if t.Status() == StatusCompleted {
+		t.setPercentComplete(0)
+	}
+	t.SetStatus(StatusInProcess)
+	t.SetCompleted(time.Time{})
+}
+
+// MarkCancelled cancels todo, partial progress is kept
+func (t *Todo) MarkCancelled() {
+	if t.Status() == StatusCompleted {
+		t.setPercentComplete(0)
+	}
+	t.SetStatus(StatusCancelled)
+	t.SetCompleted(time.Time{})
+}
+
+// Reopen marks todo as needing action and clears its progress
+func (t *Todo) Reopen() {
+	t.SetStatus(StatusNeedsAction)
+	t.SetCompleted(time.Time{})
+	t.setPercentComplete(0)
+}
+
+// SetProgress sets todo progress in percent and a matching status:
+// 0 reopens todo, 100 completes it at given time and other values start it
+func (t *Todo) SetProgress(n int, at time.Time) error {
+	switch {
+	case n < 0 || n > 100:
+		return fmt.Errorf("Invalid progress: %d, must be between 0 and 100", n)
+	case n == 0:
+		t.Reopen()
+	case n == 100:
+		if _, err := t.Complete(at); err != nil {
+			return err
+		}
+	default:
+		t.MarkInProcess()
+		t.setPercentComplete(n)
+	}
+	return nil
+}
+
+// RollUp sets todo progress from progress of its subtasks and reports whether
+// todo changed. Closed todos are kept. With setStatus, an open todo is also
+// started once its subtasks have progress and completed once all of them are done.
+func (t *Todo) RollUp(p Progress, at time.Time, setStatus bool) (bool, error) {
+	status := t.Status()
+	if status == StatusCompleted || status == StatusCancelled {
+		return false, nil
+	}
+
+	if setStatus {
+		switch {
+		case p.Total > 0 && p.Done == p.Total:
+			_, err := t.Complete(at)
+			return true, err
+		case p.Percent > 0 && status == StatusNeedsAction:
+			t.MarkInProcess()
+			t.setPercentComplete(p.Percent)
+			return true, nil
+		}
+	}
+
+	if t.PercentComplete() == p.Percent {
+		return false, nil
+	}
+	t.setPercentComplete(p.Percent)
+	return true, nil
+}
+
+// Categories returns values of all CATEGORIES props
+func (t *Todo) Categories() (categories []string) {
+	for _, p := range t.Props[ical.PropCategories] {
+		p := p
+		l, err := p.TextList()
+		if err != nil {
+			continue
+		}
+		for _, c := range l {
+			if c = strings.TrimSpace(c); c != "" {
+				categories = append(categories, c)
+			}
+		}
+	}
+	return
+}
+
+// SetCategories replaces todo categories, an empty list removes them
+func (t *Todo) SetCategories(categories []string) {
+	if len(categories) == 0 {
+		t.Props.Del(ical.PropCategories)
+		return
+	}
+	prop := ical.NewProp(ical.PropCategories)
+	prop.SetTextList(categories)
+	t.Props.Set(prop)
+}
+
+// RelatedTo returns todo relations, RELATED-TO without RELTYPE is a parent relation
+func (t *Todo) RelatedTo() (relations []Relation) {
+	for _, p := range t.Props[ical.PropRelatedTo] {
+		if r, ok := relationOf(p); ok {
+			relations = append(relations, r)
+		}
+	}
+	return
+}
+
+// SetRelatedTo replaces todo relations. Props of relations that are kept
+// stay as they are, including RELTYPE and other params.
+func (t *Todo) SetRelatedTo(relations []Relation) {
+	wanted := make(map[Relation]int)
+	for _, r := range relations {
+		wanted[r]++
+	}
+
+	var props []ical.Prop
+	for _, p := range t.Props[ical.PropRelatedTo] {
+		r, ok := relationOf(p)
+		if !ok {
+			// RELATED-TO without a UID isn't a relation and is kept
+			props = append(props, p)
+			continue
+		}
+		if wanted[r] == 0 {
+			continue
+		}
+		wanted[r]--
+		props = append(props, p)
+	}
+
+	for _, r := range relations {
+		if wanted[r] == 0 {
+			continue
+		}
+		wanted[r]--
+		prop := ical.NewProp(ical.PropRelatedTo)
+		prop.SetText(r.UID)
+		if r.Type != "" && r.Type != RelationParent {
+			prop.Params.Set(ical.ParamRelationshipType, string(r.Type))
+		}
+		props = append(props, *prop)
+	}
+
+	if len(props) == 0 {
+		t.Props.Del(ical.PropRelatedTo)
+		return
+	}
+	t.Props[ical.PropRelatedTo] = props
+}
+
+// relationOf returns a relation of RELATED-TO prop p
+func relationOf(p ical.Prop) (Relation, bool) {
+	uid, err := p.Text()
+	if err != nil || uid == "" {
+		return Relation{}, false
+	}
+	rt := RelationType(strings.ToUpper(p.Params.Get(ical.ParamRelationshipType)))
+	if rt == "" {
+		rt = RelationParent
+	}
+	return Relation{rt, uid}, true
+}
+
+// Parent returns UID of the parent todo, an empty string for top-level todos
+func (t *Todo) Parent() string {
+	for _, r := range t.RelatedTo() {
+		if r.Type == RelationParent {
+			return r.UID
+		}
+	}
+	return ""
+}
+
+// SetParent replaces parent relation of todo keeping other relations,
+// an empty uid makes todo top-level
+func (t *Todo) SetParent(uid string) {
+	var relations []Relation
+	if uid != "" {
+		relations = append(relations, Relation{RelationParent, uid})
+	}
+	for _, r := range t.RelatedTo() {
+		if r.Type != RelationParent {
+			relations = append(relations, r)
+		}
+	}
+	t.SetRelatedTo(relations)
+}
+
+// Dependencies returns UIDs of todos this todo depends on
+func (t *Todo) Dependencies() (uids []string) {
+	for _, r := range t.RelatedTo() {
+		if r.Type == RelationDependsOn {
+			uids = append(uids, r.UID)
+		}
+	}
+	return
+}
+
+// AddDependency makes todo depend on todo with given uid
+func (t *Todo) AddDependency(uid string) {
+	for _, dep := range t.Dependencies() {
+		if dep == uid {
+			return
+		}
+	}
+	t.SetRelatedTo(append(t.RelatedTo(), Relation{RelationDependsOn, uid}))
+}
+
+// RemoveDependency removes dependency on todo with given uid and reports
+// whether todo depended on it
+func (t *Todo) RemoveDependency(uid string) bool {
+	var (
+		relations []Relation
+		removed   bool
+	)
+	for _, r := range t.RelatedTo() {
+		if r.Type == RelationDependsOn && r.UID == uid {
+			removed = true
+			continue
+		}
+		relations = append(relations, r)
+	}
+	if removed {
+		t.SetRelatedTo(relations)
+	}
+	return removed
+}
+
+// RRule returns todo recurrence rule, an empty string if todo doesn't repeat
+func (t *Todo) RRule() string {
+	if p := t.Props.Get(ical.PropRecurrenceRule); p != nil {
+		return p.Value
+	}
+	return ""
+}
+
+// SetRRule sets todo recurrence rule, an empty rule removes it
+func (t *Todo) SetRRule(rule string) {
+	if rule == "" {
+		t.Props.Del(ical.PropRecurrenceRule)
+		return
+	}
+	prop := ical.NewProp(ical.PropRecurrenceRule)
+	prop.Value = rule
+	t.Props.Set(prop)
+}
+
+// Hashtags returns hashtags found in todo summary and description
+func (t *Todo) Hashtags() []Tag {
+	return parseTags(t.Summary(), t.Description())
+}
+
+// Tags returns hashtags of todo followed by its categories,
+// as set by other programs
+func (t *Todo) Tags() []Tag {
+	tags := t.Hashtags()
+	for _, c := range t.Categories() {
+		if tag := categoryTag(c); tag != "" && !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// SyncCategories adds hashtags of todo to its categories. Categories of
+// removed hashtags, which todo had before it was changed, are removed.
+func (t *Todo) SyncCategories(removed []Tag) {
+	hashtags := t.Hashtags()
+
+	var (
+		categories []string
+		tags       []Tag
+		changed    bool
+	)
+	for _, c := range t.Categories() {
+		tag := categoryTag(c)
+		if tag != "" && (containsTag(tags, tag) || containsTag(removed, tag) && !containsTag(hashtags, tag)) {
+			changed = true
+			continue
+		}
+		categories = append(categories, c)
+		tags = append(tags, tag)
+	}
+	for _, tag := range hashtags {
+		if !containsTag(tags, tag) {
+			categories = append(categories, tag.String())
+			tags = append(tags, tag)
+			changed = true
+		}
+	}
+
+	if changed {
+		t.SetCategories(categories)
+	}
+}
+
+// AddTag adds tag to todo as a hashtag at the end of summary, or as
+// a category. Nothing is added if todo already has the tag.
+func (t *Todo) AddTag(tag Tag, category bool) {
+	if containsTag(t.Tags(), tag) {
+		return
+	}
+	if category {
+		t.SetCategories(append(t.Categories(), tag.String()))
+		return
+	}
+	t.SetSummary(strings.TrimSpace(t.Summary() + " " + string(tag)))
+}
+
+// RemoveTag removes tag and its nested tags from todo summary, description
+// and categories, false if todo didn't have the tag
+func (t *Todo) RemoveTag(tag Tag) bool {
+	if !includesTag(t.Tags(), tag) {
+		return false
+	}
+
+	remove := func(found Tag) string {
+		if tag.Includes(found) {
+			return ""
+		}
+		return string(found)
+	}
+	if s := rewriteHashtags(t.Summary(), remove); s != t.Summary() {
+		t.SetSummary(s)
+	}
+	if s := rewriteHashtags(t.Description(), remove); s != t.Description() {
+		t.SetDescription(s)
+	}
+
+	var categories []string
+	for _, c := range t.Categories() {
+		if !tag.Includes(categoryTag(c)) {
+			categories = append(categories, c)
+		}
+	}
+	if len(categories) != len(t.Categories()) {
+		t.SetCategories(categories)
+	}
+	return true
+}
+
+// RenameTag replaces tag from with tag to in todo summary, description and
+// categories, keeping hashtags in place. Nested tags of from are moved under
+// to. Tags todo already has after renaming are removed instead. Renaming a tag
+// to itself in another case rewrites its spelling. False is returned if todo
+// wasn't changed.
+func (t *Todo) RenameTag(from, to Tag) bool {
+	// tags that are not renamed
+	var kept []Tag
+	for _, tag := range t.Tags() {
+		if !from.Includes(tag) {
+			kept = append(kept, tag)
+		}
+	}
+	if len(kept) == len(t.Tags()) {
+		return false
+	}
+
+	// renamed returns a new name of a renamed tag, which is empty
+	// if todo already has a tag of that name
+	renamed := func(tag Tag) Tag {
+		if r := tag.rebase(from, to); !containsTag(kept, r) {
+			return r
+		}
+		return ""
+	}
+	rename := func(found Tag) string {
+		if !from.Includes(found) {
+			return string(found)
+		}
+		return string(renamed(found))
+	}
+
+	changed := false
+	if s := rewriteHashtags(t.Summary(), rename); s != t.Summary() {
+		t.SetSummary(s)
+		changed = true
+	}
+	if s := rewriteHashtags(t.Description(), rename); s != t.Description() {
+		t.SetDescription(s)
+		changed = true
+	}
+
+	var categories []string
+	for _, c := range t.Categories() {
+		tag := categoryTag(c)
+		if !from.Includes(tag) {
+			categories = append(categories, c)
+			continue
+		}
+		if r := renamed(tag); r != "" {
+			categories = append(categories, r.String())
+			changed = changed || c != r.String()
+		} else {
+			changed = true
+		}
+	}
+	if changed {
+		t.SetCategories(categories)
+	}
+	return changed
+}
+
+// categoryTag returns a tag of todo category. Characters that can't be part
+// of a tag, such as spaces and commas, are replaced with hyphens, e.g. category
+// 'errands, misc' is tag #errands-misc. Categories without letters or digits
+// have no tag and an empty tag is returned.
+func categoryTag(c string) Tag {
+	var parts []string
+	for _, part := range strings.Split(c, "/") {
+		words := strings.FieldsFunc(part, func(r rune) bool { return !isTagRune(r) })
+		if len(words) > 0 {
+			parts = append(parts, strings.Join(words, "-"))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return Tag(tagPrefix + strings.Join(parts, "/"))
+}
@@ -0,0 +1,284 @@
+package vdir
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTodo(t *testing.T) {
+	todo := NewTodo()
+	todo.Props.SetText("X-UNKNOWN-PROP", "kept")
+
+	due := time.Date(2021, 7, 15, 0, 0, 0, 0, time.Local)
+	todo.SetSummary("buy milk #shopping")
+	todo.SetDescription("with, commas; and semicolons")
+	todo.SetStatus(StatusInProcess)
+	todo.SetPriority(PriorityMedium)
+	todo.SetDue(due, true)
+	todo.SetCategories([]string{"home", "errands, misc"})
+	todo.SetRelatedTo([]Relation{{RelationParent, "parent-uid"}, {RelationSibling, "sibling-uid"}})
+	todo.SetRRule("FREQ=WEEKLY")
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(todo.Calendar()); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := ical.NewDecoder(strings.NewReader(buf.String())).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Todo{cal.Children[0], cal}
+
+	if got.UID() != todo.UID() || got.UID() == "" {
+		t.Errorf("UID() = %q, want %q", got.UID(), todo.UID())
+	}
+	if got.Summary() != "buy milk #shopping" {
+		t.Errorf("Summary() = %q", got.Summary())
+	}
+	if got.Description() != "with, commas; and semicolons" {
+		t.Errorf("Description() = %q", got.Description())
+	}
+	if got.Status() != StatusInProcess {
+		t.Errorf("Status() = %q", got.Status())
+	}
+	if got.Priority() != PriorityMedium {
+		t.Errorf("Priority() = %d", got.Priority())
+	}
+	if d, allDay := got.Due(); !d.Equal(due) || !allDay {
+		t.Errorf("Due() = %v, %t, want %v, true", d, allDay, due)
+	}
+	if diff := cmp.Diff([]string{"home", "errands, misc"}, got.Categories()); diff != "" {
+		t.Errorf("Categories() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Relation{{RelationParent, "parent-uid"}, {RelationSibling, "sibling-uid"}}, got.RelatedTo()); diff != "" {
+		t.Errorf("RelatedTo() mismatch (-want +got):\n%s", diff)
+	}
+	if got.RRule() != "FREQ=WEEKLY" {
+		t.Errorf("RRule() = %q", got.RRule())
+	}
+	if diff := cmp.Diff([]Tag{"#shopping"}, got.Hashtags()); diff != "" {
+		t.Errorf("Hashtags() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Tag{"#shopping", "#home", "#errands-misc"}, got.Tags()); diff != "" {
+		t.Errorf("Tags() mismatch (-want +got):\n%s", diff)
+	}
+	if v, _ := got.Props.Text("X-UNKNOWN-PROP"); v != "kept" {
+		t.Errorf("unknown prop = %q, want %q", v, "kept")
+	}
+
+	got.SetDue(time.Time{}, false)
+	got.SetPriority(0)
+	got.SetDescription("")
+	for _, p := range []string{ical.PropDue, ical.PropPriority, ical.PropDescription} {
+		if got.Props.Get(p) != nil {
+			t.Errorf("%s is not removed", p)
+		}
+	}
+}
+
+func TestTodoStatusLifecycle(t *testing.T) {
+	todo := NewTodo()
+	at := time.Date(2021, 7, 15, 10, 0, 0, 0, time.UTC)
+
+	check := func(step string, status ToDoStatus, percent int, completed bool) {
+		t.Helper()
+		if todo.Status() != status {
+			t.Errorf("%s: Status() = %q, want %q", step, todo.Status(), status)
+		}
+		if todo.PercentComplete() != percent {
+			t.Errorf("%s: PercentComplete() = %d, want %d", step, todo.PercentComplete(), percent)
+		}
+		if got := !todo.Completed().IsZero(); got != completed {
+			t.Errorf("%s: has COMPLETED = %t, want %t", step, got, completed)
+		}
+	}
+
+	if err := todo.SetProgress(40, at); err != nil {
+		t.Fatal(err)
+	}
+	check("progress", StatusInProcess, 40, false)
+
+	todo.MarkCompleted(at)
+	check("complete", StatusCompleted, 100, true)
+	if !todo.Completed().Equal(at) {
+		t.Errorf("Completed() = %v, want %v", todo.Completed(), at)
+	}
+
+	todo.MarkInProcess()
+	check("start", StatusInProcess, 0, false)
+
+	if err := todo.SetProgress(60, at); err != nil {
+		t.Fatal(err)
+	}
+	todo.MarkCancelled()
+	check("cancel", StatusCancelled, 60, false)
+
+	todo.Reopen()
+	check("reopen", StatusNeedsAction, 0, false)
+
+	if err := todo.SetProgress(100, at); err != nil {
+		t.Fatal(err)
+	}
+	check("progress 100", StatusCompleted, 100, true)
+
+	if err := todo.SetProgress(101, at); err == nil {
+		t.Error("SetProgress(101) succeeded, want error")
+	}
+}
+
+func TestSetRelatedTo(t *testing.T) {
+	data := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:test",
+		"BEGIN:VTODO",
+		"UID:todo",
+		"DTSTAMP:20211114T025541Z",
+		"RELATED-TO;RELTYPE=PARENT;X-CLIENT=kept:parent-uid",
+		"RELATED-TO;RELTYPE=DEPENDS-ON;X-CLIENT=kept:design-uid",
+		"RELATED-TO;RELTYPE=DEPENDS-ON:build-uid",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := &Todo{cal.Children[0], cal}
+
+	todo.AddDependency("test-uid")
+	todo.RemoveDependency("build-uid")
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"RELATED-TO;RELTYPE=PARENT;X-CLIENT=kept:parent-uid",
+		"RELATED-TO;RELTYPE=DEPENDS-ON;X-CLIENT=kept:design-uid",
+		"RELATED-TO;RELTYPE=DEPENDS-ON:test-uid",
+	}
+	var got []string
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if strings.HasPrefix(line, "RELATED-TO") {
+			got = append(got, line)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RELATED-TO mismatch (-want +got):\n%s", diff)
+	}
+
+	todo.SetParent("other-uid")
+	relations := []Relation{{RelationDependsOn, "design-uid"}, {RelationDependsOn, "test-uid"}, {RelationParent, "other-uid"}}
+	if diff := cmp.Diff(relations, todo.RelatedTo()); diff != "" {
+		t.Errorf("RelatedTo() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSyncCategories(t *testing.T) {
+	todo := NewTodo()
+	todo.SetSummary("plan trip #Travel #work")
+	todo.SetCategories([]string{"Work", "Phone", "work"})
+
+	todo.SyncCategories(nil)
+	if diff := cmp.Diff([]string{"Work", "Phone", "Travel"}, todo.Categories()); diff != "" {
+		t.Errorf("Categories() mismatch (-want +got):\n%s", diff)
+	}
+
+	removed := todo.Hashtags()
+	todo.SetSummary("plan trip #travel")
+	todo.SyncCategories(removed)
+	if diff := cmp.Diff([]string{"Phone", "Travel"}, todo.Categories()); diff != "" {
+		t.Errorf("Categories() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTodoTags(t *testing.T) {
+	todo := NewTodo()
+	todo.SetSummary("#Urgent call #bank about #loan")
+	todo.SetDescription("ask for #bank fees\n#bank\nrate #Bank")
+	todo.SetCategories([]string{"Bank", "phone"})
+
+	if !todo.RemoveTag("#bank") {
+		t.Fatal("RemoveTag() = false, want true")
+	}
+	if todo.RemoveTag("#bank") {
+		t.Error("RemoveTag() of removed tag = true, want false")
+	}
+	if got := todo.Summary(); got != "#Urgent call about #loan" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if got := todo.Description(); got != "ask for fees\n\nrate" {
+		t.Errorf("Description() = %q", got)
+	}
+
+	todo.AddTag("#work", false)
+	todo.AddTag("#urgent", false)
+	todo.AddTag("#home", true)
+	if got := todo.Summary(); got != "#Urgent call about #loan #work" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if diff := cmp.Diff([]Tag{"#Urgent", "#loan", "#work", "#phone", "#home"}, todo.Tags()); diff != "" {
+		t.Errorf("Tags() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	todo := NewTodo()
+	todo.SetSummary("fix #Bugs in #parser")
+	todo.SetDescription("see #bugs")
+	todo.SetCategories([]string{"BUGS", "work"})
+
+	if !todo.RenameTag("#bugs", "#bug") {
+		t.Fatal("RenameTag() = false, want true")
+	}
+	if got := todo.Summary(); got != "fix #bug in #parser" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if got := todo.Description(); got != "see #bug" {
+		t.Errorf("Description() = %q", got)
+	}
+	if diff := cmp.Diff([]string{"bug", "work"}, todo.Categories()); diff != "" {
+		t.Errorf("Categories() mismatch (-want +got):\n%s", diff)
+	}
+	if todo.RenameTag("#bug", "#bug") {
+		t.Error("RenameTag() of lowercase tag to itself = true, want false")
+	}
+
+	// todos that have the new tag lose the old one
+	todo.RenameTag("#parser", "#work")
+	if got := todo.Summary(); got != "fix #bug in" {
+		t.Errorf("Summary() = %q", got)
+	}
+}
+
+func TestCategoryTags(t *testing.T) {
+	todo := NewTodo()
+	todo.SetSummary("plan #work")
+	todo.SetCategories([]string{"errands, misc", "Home Office/Q1 plans", "!!!"})
+
+	if diff := cmp.Diff([]Tag{"#work", "#errands-misc", "#Home-Office/Q1-plans"}, todo.Tags()); diff != "" {
+		t.Errorf("Tags() mismatch (-want +got):\n%s", diff)
+	}
+	for _, tag := range todo.Tags() {
+		if _, err := ParseTag(string(tag)); err != nil {
+			t.Errorf("ParseTag(%q) error: %v", tag, err)
+		}
+	}
+
+	if !todo.RemoveTag("#errands-misc") {
+		t.Error("RemoveTag() = false, want category removed")
+	}
+	if !todo.RenameTag("#home-office", "#office") {
+		t.Error("RenameTag() = false, want category renamed")
+	}
+	if diff := cmp.Diff([]string{"office/Q1-plans", "!!!"}, todo.Categories()); diff != "" {
+		t.Errorf("Categories() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,192 @@
+package vdir
+
+import "time"
+
+// TreeItem is an item placed in a subtask tree
+type TreeItem struct {
+	*Item
+	Depth int // nesting level, 0 for top-level items
+}
+
+// Tree orders items as a subtask tree, every item is followed by its
+// children. Items whose parent is not among items are placed at top level,
+// the order of items is kept otherwise.
+func Tree(items []*Item) (tree []TreeItem) {
+	byUID := make(map[string]*Item)
+	for _, item := range items {
+		if uid := item.UID(); uid != "" && byUID[uid] == nil {
+			byUID[uid] = item
+		}
+	}
+
+	children := make(map[*Item][]*Item)
+	var roots []*Item
+	for _, item := range items {
+		parent := byUID[item.ParentUID()]
+		if parent == nil || parent == item {
+			roots = append(roots, item)
+			continue
+		}
+		children[parent] = append(children[parent], item)
+	}
+
+	visited := make(map[*Item]bool)
+	var walk func(item *Item, depth int)
+	walk = func(item *Item, depth int) {
+		if visited[item] {
+			return
+		}
+		visited[item] = true
+		tree = append(tree, TreeItem{item, depth})
+		for _, child := range children[item] {
+			walk(child, depth+1)
+		}
+	}
+
+	for _, item := range roots {
+		walk(item, 0)
+	}
+	// items in a parent cycle have no root
+	for _, item := range items {
+		walk(item, 0)
+	}
+	return
+}
+
+// Progress is a completion of todo subtasks
+type Progress struct {
+	Done    int // completed subtasks
+	Total   int // subtasks that are not cancelled
+	Percent int // average progress of subtasks
+}
+
+// linkSubtasks indexes subtasks by their parent and computes progress of items
+func (v *Vdir) linkSubtasks() {
+	v.children = make(map[string][]*Item)
+	for _, item := range v.Items() {
+		if parent := item.ParentUID(); parent != "" && parent != item.UID() {
+			v.children[parent] = append(v.children[parent], item)
+		}
+	}
+	for _, item := range v.Items() {
+		item.progress = v.Progress(item)
+	}
+}
+
+// Children returns todos that have item as their parent
+func (v *Vdir) Children(item *Item) []*Item {
+	if uid := item.UID(); uid != "" {
+		return v.children[uid]
+	}
+	return nil
+}
+
+// Parent returns the parent todo of item or nil for top-level todos
+func (v *Vdir) Parent(item *Item) *Item {
+	uid := item.ParentUID()
+	if uid == "" || uid == item.UID() {
+		return nil
+	}
+	parent, err := v.ItemByUID(uid)
+	if err != nil {
+		return nil
+	}
+	return parent
+}
+
+// Descendants returns children of item, their children and so on
+func (v *Vdir) Descendants(item *Item) (descendants []*Item) {
+	seen := map[*Item]bool{item: true}
+	queue := []*Item{item}
+	for len(queue) > 0 {
+		for _, child := range v.Children(queue[0]) {
+			if !seen[child] {
+				seen[child] = true
+				descendants = append(descendants, child)
+				queue = append(queue, child)
+			}
+		}
+		queue = queue[1:]
+	}
+	return
+}
+
+// Progress returns completion of item subtasks. Completed subtasks count as
+// done, cancelled ones are not counted, others contribute their own progress
+// or progress of their subtasks.
+func (v *Vdir) Progress(item *Item) Progress {
+	return v.progress(item, map[*Item]bool{item: true})
+}
+
+func (v *Vdir) progress(item *Item, seen map[*Item]bool) (p Progress) {
+	sum := 0
+	for _, child := range v.Children(item) {
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+
+		m, err := child.metadata()
+		if err != nil {
+			continue
+		}
+		switch m.Status {
+		case StatusCancelled:
+			continue
+		case StatusCompleted:
+			p.Done++
+			sum += 100
+		default:
+			if cp := v.progress(child, seen); cp.Total > 0 {
+				sum += cp.Percent
+			} else {
+				sum += m.Percent
+			}
+		}
+		p.Total++
+	}
+	if p.Total > 0 {
+		p.Percent = sum / p.Total
+	}
+	return
+}
+
+// RollUp updates progress of item ancestors after the item was changed and
+// returns ancestors that were written. With setStatus, a parent is started
+// once its subtasks have progress and completed once all of them are done.
+func (v *Vdir) RollUp(item *Item, at time.Time, setStatus bool) (updated []*Item, err error) {
+	seen := map[*Item]bool{item: true}
+	for parent := v.Parent(item); parent != nil && !seen[parent]; parent = v.Parent(parent) {
+		seen[parent] = true
+
+		p := v.Progress(parent)
+		parent.progress = p
+
+		t, err := parent.Todo()
+		if err != nil {
+			return updated, err
+		}
+		changed, err := t.RollUp(p, at, setStatus)
+		if err != nil {
+			return updated, err
+		}
+		if !changed {
+			continue
+		}
+
+		// the change is applied again if file is re-read after a conflict
+		err = parent.Update(func(i *Item) error {
+			t, err := i.Todo()
+			if err != nil {
+				return err
+			}
+			_, err = t.RollUp(p, at, setStatus)
+			return err
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated = append(updated, parent)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package vdir
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTree(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{UID: "child", Parent: "root"},
+		testTodo{UID: "orphan", Parent: "missing"},
+		testTodo{UID: "root"},
+		testTodo{UID: "grandchild", Parent: "child"},
+		testTodo{UID: "cycle-a", Parent: "cycle-b"},
+		testTodo{UID: "cycle-b", Parent: "cycle-a"},
+	)
+
+	var got [][2]int
+	for _, i := range Tree(v.Items()) {
+		got = append(got, [2]int{i.Id, i.Depth})
+	}
+	want := [][2]int{{2, 0}, {3, 0}, {1, 1}, {4, 2}, {5, 0}, {6, 1}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Tree() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{UID: "project", Status: StatusNeedsAction},
+		testTodo{UID: "a", Parent: "project", Status: StatusCompleted, Percent: 100},
+		testTodo{UID: "b", Parent: "project", Status: StatusInProcess, Percent: 40},
+		testTodo{UID: "c", Parent: "project", Status: StatusCancelled},
+		testTodo{UID: "d", Parent: "project", Status: StatusNeedsAction},
+		testTodo{UID: "d1", Parent: "d", Status: StatusCompleted, Percent: 100},
+		testTodo{UID: "d2", Parent: "d", Status: StatusNeedsAction},
+	)
+	project, err := v.ItemByUID("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// d contributes progress of its subtasks: (100 + 40 + 50) / 3
+	want := Progress{Done: 1, Total: 3, Percent: 63}
+	if got := project.SubtaskProgress(); got != want {
+		t.Errorf("SubtaskProgress() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTodoRollUp(t *testing.T) {
+	at := time.Date(2021, 7, 15, 10, 0, 0, 0, time.UTC)
+	todo := NewTodo()
+
+	if changed, _ := todo.RollUp(Progress{Done: 0, Total: 2}, at, true); changed {
+		t.Error("RollUp() without progress changed todo")
+	}
+
+	// without setStatus only progress changes
+	if changed, _ := todo.RollUp(Progress{Done: 1, Total: 2, Percent: 50}, at, false); !changed || todo.Status() != StatusNeedsAction || todo.PercentComplete() != 50 {
+		t.Errorf("RollUp() = %t, status %q, %d%%, want todo needing action at 50%%", changed, todo.Status(), todo.PercentComplete())
+	}
+	if changed, _ := todo.RollUp(Progress{Done: 2, Total: 2, Percent: 100}, at, false); !changed || todo.Status() != StatusNeedsAction || todo.PercentComplete() != 100 {
+		t.Errorf("RollUp() = %t, status %q, %d%%, want todo needing action at 100%%", changed, todo.Status(), todo.PercentComplete())
+	}
+
+	if changed, _ := todo.RollUp(Progress{Done: 1, Total: 2, Percent: 50}, at, true); !changed || todo.Status() != StatusInProcess || todo.PercentComplete() != 50 {
+		t.Errorf("RollUp() = %t, status %q, %d%%, want started todo at 50%%", changed, todo.Status(), todo.PercentComplete())
+	}
+	if changed, _ := todo.RollUp(Progress{Done: 2, Total: 2, Percent: 100}, at, true); !changed || todo.Status() != StatusCompleted {
+		t.Errorf("RollUp() = %t, status %q, want completed todo", changed, todo.Status())
+	}
+}
@@ -9,15 +9,40 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/emersion/go-ical"
 )
 
-// Vdir is a map of all collections and items
-type Vdir map[*Collection][]*Item
+// Vdir is a set of collections and their items, kept in a stable order
+type Vdir struct {
+	Path string
 
-// Init initializes the map with collections and items in path, items have unique IDs
-func (v *Vdir) Init(path string) error {
+	lockPath    string // lock file serializing writes to vdir
+	collections []*Collection
+	items       map[*Collection][]*Item
+	children    map[string][]*Item // subtasks by parent UID
+}
+
+type InitOption int
+
+const (
+	// InitCache makes Init use an on-disk metadata cache and decode
+	// item files lazily, only when they are changed or formatted
+	InitCache InitOption = iota
+)
+
+// loadWorkers is a number of goroutines decoding item files in Init
+var loadWorkers = runtime.NumCPU()
+
+// Init initializes vdir with collections and items in path, items have unique IDs
+// that are persisted in an index file and stay stable across runs.
+// Collections and their items are ordered by path.
+func (v *Vdir) Init(path string, options ...InitOption) error {
 	f, err := os.Stat(path)
 	if errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("Vdir path does not exist: %q", path)
@@ -26,7 +51,18 @@ func (v *Vdir) Init(path string) error {
 		return fmt.Errorf("Vdir path is not a directory: %q", path)
 	}
 
-	var itemId int
+	v.Path = path
+	v.lockPath = filepath.Join(path, LockFile)
+	v.collections = nil
+	v.items = make(map[*Collection][]*Item)
+
+	// collect item files first, so that they can be decoded concurrently
+	type job struct {
+		col  *Collection
+		path string
+		info fs.FileInfo
+	}
+	var jobs []job
 
 	walkFunc := func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -42,15 +78,11 @@ func (v *Vdir) Init(path string) error {
 				c.Path,
 				func(pp string, dd fs.DirEntry, err error) error {
 					if isIcal(pp, dd) {
-						item := new(Item)
-						if err := item.Init(pp); err != nil {
-							log.Println(err)
-						}
-						if item.Ical != nil {
-							itemId++
-							item.Id = itemId
-							(*v)[c] = append((*v)[c], item)
+						info, err := dd.Info()
+						if err != nil {
+							return err
 						}
+						jobs = append(jobs, job{c, pp, info})
 					}
 					return nil
 				},
@@ -67,16 +99,165 @@ func (v *Vdir) Init(path string) error {
 		return err
 	}
 
+	var cache *itemCache
+	for _, opt := range options {
+		if opt == InitCache {
+			cache = loadCache(path)
+		}
+	}
+
+	// take fresh items from cache and decode the rest
+	var (
+		decoded = make([][]*Item, len(jobs))
+		paths   []string
+		pending []int
+	)
+	for n, j := range jobs {
+		if cache != nil {
+			if e, ok := cache.get(j.path, j.info); ok {
+				f := &itemFile{
+					path:  j.path,
+					state: fileState{modTime: e.ModTime, size: e.Size},
+				}
+				for index, meta := range e.Todos {
+					decoded[n] = append(decoded[n], &Item{
+						Path:  j.path,
+						file:  f,
+						index: index,
+						meta:  meta,
+					})
+				}
+				continue
+			}
+		}
+		paths = append(paths, j.path)
+		pending = append(pending, n)
+	}
+	for n, f := range loadFiles(paths, loadWorkers) {
+		if f == nil {
+			continue
+		}
+		items := f.items()
+		decoded[pending[n]] = items
+		if cache == nil {
+			continue
+		}
+		var todos []*itemMeta
+		for _, item := range items {
+			m, err := item.metadata()
+			if err != nil {
+				log.Println(&DecodeError{item.Path, err})
+				continue
+			}
+			todos = append(todos, m)
+		}
+		if len(todos) == len(items) {
+			cache.put(f.path, f.state.modTime, f.state.size, todos)
+		}
+	}
+
+	// assemble results in walk order to keep collections and IDs deterministic
+	var (
+		items []*Item
+		keys  []string
+		seen  = make(map[string]bool)
+	)
+	for n, fileItems := range decoded {
+		for _, item := range fileItems {
+			// fall back to path for todos without UID or with duplicate UIDs
+			key := item.key()
+			if key == "" || seen[key] {
+				key = item.Path
+				if item.index > 0 {
+					key = fmt.Sprintf("%s#%d", item.Path, item.index)
+				}
+			}
+			seen[key] = true
+			item.lockPath = v.lockPath
+			items = append(items, item)
+			keys = append(keys, key)
+			col := jobs[n].col
+			if _, ok := v.items[col]; !ok {
+				v.collections = append(v.collections, col)
+			}
+			v.items[col] = append(v.items[col], item)
+		}
+	}
+
+	v.linkSubtasks()
+	for _, item := range v.Items() {
+		v.RefreshBlockers(item)
+	}
+
+	l, err := lockFile(v.lockPath)
+	if err != nil {
+		return err
+	}
+	defer l.unlock() // nolint: errcheck
+
+	idx, err := loadIDIndex(indexPath(path))
+	if err != nil {
+		return err
+	}
+	ids := idx.assign(keys, time.Now())
+	for n, item := range items {
+		item.Id = ids[keys[n]]
+	}
+
+	if err := idx.save(); err != nil {
+		return err
+	}
+
+	if cache != nil {
+		all := make([]string, len(jobs))
+		for n, j := range jobs {
+			all[n] = j.path
+		}
+		cache.prune(all)
+		return cache.save()
+	}
+
 	return nil
 }
 
+// loadFiles decodes files at paths using a bounded pool of workers,
+// results have the same order as paths and are nil for files that failed to decode
+func loadFiles(paths []string, workers int) []*itemFile {
+	files := make([]*itemFile, len(paths))
+	if workers < 1 {
+		workers = 1
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range next {
+				f := &itemFile{path: paths[n]}
+				if err := f.read(); err != nil {
+					log.Println(err)
+					continue
+				}
+				files[n] = f
+			}
+		}()
+	}
+	for n := range paths {
+		next <- n
+	}
+	close(next)
+	wg.Wait()
+
+	return files
+}
+
 // ItemById finds and returns an item for specified id
 func (v *Vdir) ItemById(id int) (*Item, error) {
-	for _, items := range *v {
-		for _, item := range items {
-			if item.Id == id {
-				return item, nil
-			}
+	for _, item := range v.Items() {
+		if item.Id == id {
+			return item, nil
 		}
 	}
 	return nil, fmt.Errorf("Item not found: %d", id)
@@ -84,42 +265,195 @@ func (v *Vdir) ItemById(id int) (*Item, error) {
 
 // ItemByPath finds and returns an item for specified path
 func (v *Vdir) ItemByPath(path string) (*Item, error) {
-	for _, items := range *v {
-		for _, item := range items {
-			if item.Path == path {
-				return item, nil
-			}
+	for _, item := range v.Items() {
+		if item.Path == path {
+			return item, nil
 		}
 	}
 	return nil, fmt.Errorf("Item not found: %q", path)
 }
 
+// ItemByUID finds and returns an item for specified UID,
+// recurring todos are returned without their recurrence overrides
+func (v *Vdir) ItemByUID(uid string) (*Item, error) {
+	var found *Item
+	for _, item := range v.Items() {
+		if item.UID() != uid {
+			continue
+		}
+		if m, err := item.metadata(); err == nil && m.RecurrenceID == "" {
+			return item, nil
+		}
+		if found == nil {
+			found = item
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("Item not found: %q", uid)
+	}
+	return found, nil
+}
+
+// ItemByUIDPrefix finds and returns an item whose UID starts with prefix,
+// the prefix must match exactly one item
+func (v *Vdir) ItemByUIDPrefix(prefix string) (*Item, error) {
+	if prefix == "" {
+		return nil, errors.New("Empty UID prefix")
+	}
+
+	// recurrence overrides share UID with their todo and are not counted
+	var found, exact []*Item
+	for _, item := range v.Items() {
+		m, err := item.metadata()
+		if err != nil || m.RecurrenceID != "" || !strings.HasPrefix(m.UID, prefix) {
+			continue
+		}
+		found = append(found, item)
+		if m.UID == prefix {
+			exact = append(exact, item)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0], nil
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("Item not found: %q", prefix)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("Ambiguous UID prefix: %q matches %d items", prefix, len(found))
+	}
+}
+
+// Collections returns a slice of collections that contain todos, ordered by path
+func (v *Vdir) Collections() []*Collection {
+	return v.collections
+}
+
+// CollectionByName finds and returns a collection for specified name
+func (v *Vdir) CollectionByName(name string) (*Collection, error) {
+	for _, col := range v.collections {
+		if col.Name == name {
+			return col, nil
+		}
+	}
+	return nil, fmt.Errorf("List does not exist: %q", name)
+}
+
+// NewItem returns a new item for todo t in collection c, it's written to
+// a file named by todo UID
+func (v *Vdir) NewItem(c *Collection, t *Todo) *Item {
+	return &Item{
+		Path:     filepath.Join(c.Path, t.UID()+".ics"),
+		Ical:     t.Calendar(),
+		lockPath: v.lockPath,
+	}
+}
+
+// CollectionNames returns a slice of collection names
+func (v *Vdir) CollectionNames() []string {
+	names := make([]string, len(v.collections))
+	for n, col := range v.collections {
+		names[n] = col.Name
+	}
+	return names
+}
+
+// CollectionItems returns items of collection c
+func (v *Vdir) CollectionItems(c *Collection) []*Item {
+	return v.items[c]
+}
+
+// Items returns a slice of all items in vdir, ordered by collection
+func (v *Vdir) Items() []*Item {
+	var all []*Item
+	for _, col := range v.collections {
+		all = append(all, v.items[col]...)
+	}
+	return all
+}
+
+// Walk calls fn for each item in vdir, ordered by collection.
+// If fn returns an error, walking stops and the error is returned.
+func (v *Vdir) Walk(fn func(c *Collection, item *Item) error) error {
+	for _, col := range v.collections {
+		for _, item := range v.items[col] {
+			if err := fn(col, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Tags returns a slice of all tags found in todos inside vdir
 func (v *Vdir) Tags() (tags []Tag, err error) {
-	containsTag := func(tags []Tag, tag Tag) bool {
-		for _, t := range tags {
-			if tag == t {
-				return true
+	for _, item := range v.Items() {
+		tt, err := item.Tags()
+		if err != nil {
+			return tags, err
+		}
+		for _, tag := range tt {
+			if !containsTag(tags, tag) {
+				tags = append(tags, tag)
 			}
 		}
-		return false
 	}
 
-	for _, items := range *v {
-		for _, item := range items {
-			tt, err := item.Tags()
-			if err != nil {
-				return tags, err
-			}
-			for _, tag := range tt {
-				if !containsTag(tags, tag) {
-					tags = append(tags, tag)
+	return
+}
+
+// TagCount is a number of open and all todos having a tag
+type TagCount struct {
+	Tag   Tag
+	Open  int
+	Total int
+}
+
+// TagCounts returns numbers of todos for every tag in vdir, ordered by tag.
+// Like filtering by tag, counts ignore case and include nested tags, e.g. #work
+// counts todos having #Work or #work/billing. Tags are shown in case of their
+// first occurrence.
+func (v *Vdir) TagCounts() ([]TagCount, error) {
+	counts := make(map[string]*TagCount)
+	for _, item := range v.Items() {
+		m, err := item.metadata()
+		if err != nil {
+			return nil, err
+		}
+		counted := make(map[string]bool)
+		for _, tag := range m.Tags {
+			parts := strings.Split(string(tag), "/")
+			for n := range parts {
+				t := Tag(strings.Join(parts[:n+1], "/"))
+				if counted[t.key()] {
+					continue
+				}
+				counted[t.key()] = true
+
+				c, ok := counts[t.key()]
+				if !ok {
+					c = &TagCount{Tag: t}
+					counts[t.key()] = c
+				}
+				c.Total++
+				if m.Status == StatusNeedsAction || m.Status == StatusInProcess {
+					c.Open++
 				}
 			}
 		}
 	}
 
-	return
+	result := make([]TagCount, 0, len(counts))
+	for _, c := range counts {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Tag.key() < result[j].Tag.key()
+	})
+	return result, nil
 }
 
 // isIcal reports whether path is a file that has an ical extension
@@ -4,14 +4,19 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-ical"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestInit(t *testing.T) {
 	cwd, _ := os.Getwd()
-	vdpath := path.Join(cwd, "testdata/vdir/corrupted/")
+	vdpath := t.TempDir()
+	copyDir(t, path.Join(cwd, "testdata/vdir/corrupted/"), vdpath)
 	var tests = []struct {
 		path string
 	}{
@@ -19,16 +24,352 @@ func TestInit(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run("", func(t *testing.T) {
-			vd := Vdir{}
+			vd := &Vdir{}
 			if err := vd.Init(tt.path); err != nil {
 				t.Fatal(err)
 			}
-			for col, items := range vd {
-				for _, item := range items {
-					summary := item.Ical.Children[0].Props.Get(ical.PropSummary)
-					fmt.Printf("%s: %+s\n", col, summary)
+			err := vd.Walk(func(col *Collection, item *Item) error {
+				summary := item.Ical.Children[0].Props.Get(ical.PropSummary)
+				fmt.Printf("%s: %+s\n", col, summary)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCollections(t *testing.T) {
+	cwd, _ := os.Getwd()
+	vdpath := t.TempDir()
+	copyDir(t, path.Join(cwd, "testdata/vdir/"), vdpath)
+
+	vd := &Vdir{}
+	if err := vd.Init(vdpath); err != nil {
+		t.Fatal(err)
+	}
+
+	// collections without todos are skipped
+	want := []string{"corrupted", "other_tasks", "tasks", "with_tags"}
+	if diff := cmp.Diff(want, vd.CollectionNames()); diff != "" {
+		t.Errorf("CollectionNames() mismatch (-want +got):\n%s", diff)
+	}
+
+	col, err := vd.CollectionByName("tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(vd.CollectionItems(col)); got != 4 {
+		t.Errorf("CollectionItems(): want 4 items, got %d", got)
+	}
+	if _, err := vd.CollectionByName("missing"); err == nil {
+		t.Error("CollectionByName(): want error for missing collection")
+	}
+}
+
+func TestInitStableIds(t *testing.T) {
+	cwd, _ := os.Getwd()
+	src := path.Join(cwd, "testdata/vdir/tasks/")
+	dir := t.TempDir()
+	copyDir(t, src, dir)
+
+	idsByPath := func() map[string]int {
+		vd := &Vdir{}
+		if err := vd.Init(dir); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]int)
+		for _, item := range vd.Items() {
+			m[filepath.Base(item.Path)] = item.Id
+		}
+		return m
+	}
+
+	before := idsByPath()
+
+	// removing a todo must not shift other IDs
+	removed := "20070313T123432Z-456553@example.com.ics"
+	if err := os.Remove(filepath.Join(dir, removed)); err != nil {
+		t.Fatal(err)
+	}
+	after := idsByPath()
+	for name, id := range after {
+		if before[name] != id {
+			t.Errorf("ID of %s changed: want %d, got %d", name, before[name], id)
+		}
+	}
+
+	// a new todo doesn't get the ID of a recently removed one
+	data, err := os.ReadFile(filepath.Join(src, removed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.ReplaceAll(string(data), "456553@example.com", "new@example.com"))
+	if err := os.WriteFile(filepath.Join(dir, "new.ics"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	added := idsByPath()
+	if added["new.ics"] == before[removed] {
+		t.Errorf("new todo got ID %d of a recently removed todo", added["new.ics"])
+	}
+}
+
+func TestIDIndexReuse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), IDIndexFile)
+	now := time.Date(2021, 7, 14, 12, 0, 0, 0, time.UTC)
+
+	// assign loads the index, assigns IDs and saves it like Init does
+	assign := func(now time.Time, keys ...string) map[string]int {
+		idx, err := loadIDIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := idx.assign(keys, now)
+		if err := idx.save(); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	assign(now, "a", "b", "c")
+	if diff := cmp.Diff(map[string]int{"a": 1, "c": 3, "d": 4}, assign(now.Add(time.Hour), "a", "c", "d")); diff != "" {
+		t.Errorf("IDs after removal mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int{"a": 1, "c": 3, "d": 4, "e": 5}, assign(now.Add(24*time.Hour), "a", "c", "d", "e")); diff != "" {
+		t.Errorf("IDs before reuse delay mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]int{"a": 1, "c": 3, "d": 4, "e": 5, "f": 2}, assign(now.Add(26*time.Hour), "a", "c", "d", "e", "f")); diff != "" {
+		t.Errorf("IDs after reuse delay mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			sub := filepath.Join(dst, e.Name())
+			if err := os.Mkdir(sub, 0755); err != nil {
+				t.Fatal(err)
+			}
+			copyDir(t, filepath.Join(src, e.Name()), sub)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInitDeterministic(t *testing.T) {
+	cwd, _ := os.Getwd()
+	dir := t.TempDir()
+	generateVdir(t, dir, 4, 200)
+
+	load := func(workers int) map[string]int {
+		defer func(w int) { loadWorkers = w }(loadWorkers)
+		loadWorkers = workers
+
+		vd := &Vdir{}
+		if err := vd.Init(dir); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]int)
+		for _, col := range vd.Collections() {
+			for _, item := range vd.CollectionItems(col) {
+				rel, _ := filepath.Rel(cwd, item.Path)
+				m[col.Name+"/"+rel] = item.Id
+			}
+		}
+		return m
+	}
+
+	serial := load(1)
+	// remove index to force fresh ID assignment
+	if err := os.Remove(filepath.Join(dir, IDIndexFile)); err != nil {
+		t.Fatal(err)
+	}
+	parallel := load(8)
+
+	if diff := cmp.Diff(serial, parallel); diff != "" {
+		t.Errorf("parallel Init mismatch (-serial +parallel):\n%s", diff)
+	}
+}
+
+func BenchmarkInit(b *testing.B) {
+	dir := b.TempDir()
+	generateVdir(b, dir, 4, 2500)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			defer func(w int) { loadWorkers = w }(loadWorkers)
+			loadWorkers = workers
+
+			for n := 0; n < b.N; n++ {
+				vd := &Vdir{}
+				if err := vd.Init(dir); err != nil {
+					b.Fatal(err)
 				}
 			}
 		})
 	}
 }
+
+// generateVdir creates cols collections with n todos each in dir
+func generateVdir(tb testing.TB, dir string, cols, n int) {
+	tb.Helper()
+	for c := 0; c < cols; c++ {
+		colPath := filepath.Join(dir, fmt.Sprintf("list%d", c))
+		if err := os.Mkdir(colPath, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			uid := fmt.Sprintf("%d-%d@example.com", c, i)
+			data := fmt.Sprintf(strings.Join([]string{
+				"BEGIN:VCALENDAR",
+				"VERSION:2.0",
+				"PRODID:example.com",
+				"BEGIN:VTODO",
+				"UID:%s",
+				"DTSTAMP:20210919T180624Z",
+				"CREATED:20210919T180624Z",
+				"DUE:20210921T180624Z",
+				"PRIORITY:%d",
+				"STATUS:COMPLETED",
+				"SUMMARY:Todo number %d #tag%d",
+				"DESCRIPTION:Generated todo",
+				"END:VTODO",
+				"END:VCALENDAR",
+				"",
+			}, "\r\n"), uid, i%10, i, i%5)
+			if err := os.WriteFile(filepath.Join(colPath, uid+".ics"), []byte(data), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestInitCache(t *testing.T) {
+	cwd, _ := os.Getwd()
+	src := path.Join(cwd, "testdata/vdir/tasks/")
+	dir := t.TempDir()
+	copyDir(t, src, dir)
+
+	summaries := func() map[string]string {
+		vd := &Vdir{}
+		if err := vd.Init(dir, InitCache); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]string)
+		for _, item := range vd.Items() {
+			meta, err := item.metadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[filepath.Base(item.Path)] = meta.Summary
+		}
+		return m
+	}
+
+	first := summaries()
+	if _, err := os.Stat(filepath.Join(dir, CacheFile)); err != nil {
+		t.Fatalf("cache file not written: %v", err)
+	}
+
+	// cached items are not decoded until needed
+	vd := &Vdir{}
+	if err := vd.Init(dir, InitCache); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range vd.Items() {
+		if item.Ical != nil {
+			t.Errorf("cached item was decoded: %s", item.Path)
+		}
+	}
+
+	// stale entries are refreshed
+	name := "20070313T123432Z-456553@example.com.ics"
+	p := filepath.Join(dir, name)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "SUMMARY:", "SUMMARY:Changed ", 1))
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	second := summaries()
+	if want := "Changed " + first[name]; second[name] != want {
+		t.Errorf("stale cache entry: want %q, got %q", want, second[name])
+	}
+}
+
+func TestTagCounts(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{Summary: "#work #bug", Status: StatusNeedsAction},
+		testTodo{Summary: "#bug", Status: StatusCompleted},
+		testTodo{Summary: "#bug", Status: StatusInProcess},
+		testTodo{Summary: "#Bug/ui #BUG/ui/menu", Status: StatusNeedsAction},
+		testTodo{Summary: "#work/billing", Status: StatusCompleted},
+	)
+
+	got, err := v.TagCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// counts are the numbers of todos --tag selects
+	want := []TagCount{
+		{"#bug", 3, 4},
+		{"#bug/ui", 1, 1},
+		{"#bug/ui/menu", 1, 1},
+		{"#work", 1, 2},
+		{"#work/billing", 0, 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TagCounts() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestItemByUIDPrefix(t *testing.T) {
+	v := newTestVdir(t,
+		testTodo{UID: "e0a2"},
+		testTodo{UID: "e0a2e171-8314"},
+		testTodo{UID: "e0b5-1234"},
+		testTodo{UID: "e0a2e171-8314", RecurrenceID: time.Date(2021, 11, 14, 9, 0, 0, 0, time.UTC)},
+	)
+	items := v.Items()
+	short, long, other := items[0], items[1], items[2]
+
+	var tests = []struct {
+		prefix  string
+		want    *Item
+		wantErr bool
+	}{
+		{"e0a2e1", long, false},
+		{"e0b", other, false},
+		{"e0a2", short, false}, // exact match wins over longer UIDs
+		{"e0", nil, true},      // ambiguous
+		{"f00", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, err := v.ItemByUIDPrefix(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ItemByUIDPrefix(%q) error = %v, wantErr %v", tt.prefix, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ItemByUIDPrefix(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}